@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"stator"
 	"sync"
@@ -13,11 +14,21 @@ import (
 	"github.com/clarktrimble/hondo"
 	"github.com/clarktrimble/launch"
 	"github.com/clarktrimble/sabot"
+	"github.com/pkg/errors"
 
+	"stator/collector/cgroup"
+	"stator/collector/diskstats"
 	"stator/collector/diskusage"
+	"stator/collector/host"
+	"stator/collector/netdev"
+	"stator/collector/process"
+	"stator/collector/scrape"
 	"stator/collector/wave"
 	"stator/roster"
+	"stator/roster/entity"
 	"stator/roster/registrar/consul"
+	"stator/roster/registrar/filesd"
+	"stator/roster/registrar/httpsd"
 )
 
 const (
@@ -32,13 +43,25 @@ var (
 )
 
 type Config struct {
-	Version   string            `json:"version" ignored:"true"`
-	Logger    *sabot.Config     `json:"logger"`
-	Client    *giant.Config     `json:"consul_http_client"`
-	Consul    *consul.Config    `json:"consul"`
-	Roster    *roster.Config    `json:"roster"`
-	DiskUsage *diskusage.Config `json:"disk_usage"`
-	Server    *delish.Config    `json:"http_server"`
+	Version    string                  `json:"version" ignored:"true"`
+	Logger     *sabot.Config           `json:"logger"`
+	Client     *giant.Config           `json:"consul_http_client"`
+	Consul     *consul.Config          `json:"consul"`
+	Catalog    *consul.CatalogConfig   `json:"consul_catalog"`
+	FileSd     *filesd.Config          `json:"filesd"`
+	Registrars []string                `json:"registrars" desc:"registrars, each of consul agent, consul catalog lacking a local agent, or filesd" default:"agent"`
+	Roster     *roster.Config          `json:"roster"`
+	Registry   *httpsd.RegistryConfig  `json:"sd_registry"`
+	DiskUsage  *diskusage.Config       `json:"disk_usage"`
+	DiskStats  *diskstats.Config       `json:"disk_stats"`
+	Host       *host.Config            `json:"host"`
+	NetDev     *netdev.Config          `json:"netdev"`
+	Process    *process.Config         `json:"process"`
+	Cgroup     *cgroup.Config          `json:"cgroup"`
+	Scrape     *scrape.Config          `json:"scrape"`
+	Discovery  *consul.DiscoveryConfig `json:"consul_discovery"`
+	Watch      *roster.WatchConfig     `json:"scrape_watch"`
+	Server     *delish.Config          `json:"http_server"`
 }
 
 func main() {
@@ -61,22 +84,109 @@ func main() {
 	rtr.HandleFunc("GET /config", delish.ObjHandler("config", cfg, lgr))
 	rtr.HandleFunc("GET /monitor", delish.ObjHandler("status", "ok", lgr))
 
-	// setup and start registration
-
-	client := cfg.Client.NewWithTrippers(lgr)
-	csl := cfg.Consul.New(client)
-	rstr := cfg.Roster.New(cfg.Server.Port, csl, lgr)
-	rstr.Start(ctx, &wg)
-
 	// setup stats expositor
 
 	svc := stator.ExposeRuntime(appId, runId, rtr, lgr)
-	svc.AddCollector(cfg.DiskUsage.New())
+	svc.AddCollector(cfg.DiskUsage.New(lgr))
+	if cfg.DiskStats.Enable {
+		if len(cfg.DiskStats.Paths) == 0 {
+			cfg.DiskStats.Paths = cfg.DiskUsage.Paths
+		}
+		svc.AddCollector(cfg.DiskStats.New())
+	}
+	if cfg.Host.Enable {
+		svc.AddCollector(cfg.Host.New())
+	}
+	if cfg.NetDev.Enable {
+		svc.AddCollector(cfg.NetDev.New())
+	}
+	if cfg.Process.Enable {
+		svc.AddCollector(cfg.Process.New())
+	}
+	if cfg.Cgroup.Enable {
+		svc.AddCollector(cfg.Cgroup.New())
+	}
 	svc.AddCollector(wave.New())
+	scr := cfg.Scrape.New(lgr)
+	svc.AddScraper(scr)
 
-	// start api server and wait for shutdown
+	// serve as registry when so configured
 
-	server := cfg.Server.NewWithLog(ctx, rtr, lgr)
-	server.Start(ctx, &wg)
+	if cfg.Registry.Serve {
+		cfg.Registry.New(rtr, lgr)
+	}
+
+	// setup and start registration
+
+	client := cfg.Client.NewWithTrippers(lgr)
+	tripper := cfg.Consul.Tripper(lgr)
+	client.Use(tripper)
+
+	if len(cfg.Registrars) == 0 {
+		launch.Check(ctx, lgr, errors.Errorf("no registrars, expected any of agent, catalog or filesd"))
+	}
+
+	rosters := roster.NewSet(lgr)
+	for _, name := range cfg.Registrars {
+
+		var registrar roster.Registrar
+		switch name {
+		case "agent":
+			registrar = cfg.Consul.New(client)
+		case "catalog":
+			registrar = cfg.Catalog.New(client, cfg.Consul)
+		case "filesd":
+			registrar = cfg.FileSd.New()
+		default:
+			launch.Check(ctx, lgr, errors.Errorf("unknown registrar %q, expected agent, catalog or filesd", name))
+		}
+
+		rstr := cfg.Roster.New(cfg.Server.Port, registrar, lgr)
+		rstr.Health = svc.Health
+		rosters.Add(name, rstr)
+	}
+	svc.AddUnchecked(rosters)
+
+	// collectors all added, as heartbeat runs them
+
+	rosters.Start(ctx, &wg)
+
+	// scrape instances of watched service, other than ourselves, when so configured,
+	// our address being resolved by the time discovery comes back, if not at first
+
+	if cfg.Watch.Name != "" {
+		static := scr.Targets
+		dsc := cfg.Discovery.New(cfg.Consul.NewIndexed(cfg.Client.BaseUri, tripper))
+		wtc := cfg.Watch.New(dsc, lgr, func(svcs []entity.Service) {
+			targets := append([]scrape.Target{}, static...)
+			for _, svc := range svcs {
+				targets = append(targets, scrape.Target{
+					Url:     fmt.Sprintf("http://%s:%d/metrics", svc.IpAddress, svc.Port),
+					Timeout: cfg.Scrape.Timeout,
+				})
+			}
+			scr.SetTargets(targets)
+		})
+		wtc.Self = rosters.Pairs[0].Roster.Current
+		wtc.Start(ctx, &wg)
+	}
+
+	rtr.HandleFunc("GET /roster", rosters.GetStatus)
+	if cfg.Roster.MaintenanceApi {
+		rtr.HandleFunc("PUT /roster/maintenance", rosters.PutMaintenance)
+	}
+
+	// start api server, shutting it down only once rosters have drained, and wait for shutdown
+
+	stopped := rosters.Stopped()
+	srvCtx, stopServer := context.WithCancel(context.WithoutCancel(ctx))
+	go func() {
+		<-ctx.Done()
+		<-stopped
+		stopServer()
+	}()
+
+	server := cfg.Server.NewWithLog(srvCtx, rtr, lgr)
+	server.Start(srvCtx, &wg)
 	graceful.Wait(ctx)
 }
@@ -0,0 +1,363 @@
+// Package cgroup collects resource limits and usage of the current process's cgroup v2.
+package cgroup
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"stator/entity"
+)
+
+const (
+	name = "cgroup"
+
+	// unlimited is written in place of a limit when there is none.
+	unlimited = "max"
+)
+
+var (
+	cpuStats = []cpuStat{
+		{key: "usage_usec", name: "cpu_usage_seconds", desc: "Cpu time consumed", usec: true},
+		{key: "nr_periods", name: "cpu_periods", desc: "Enforcement periods elapsed"},
+		{key: "nr_throttled", name: "cpu_throttled_periods", desc: "Enforcement periods in which the cgroup was throttled"},
+		{key: "throttled_usec", name: "cpu_throttled_seconds", desc: "Time the cgroup spent throttled", usec: true},
+	}
+
+	ioStats = []ioStat{
+		{key: "rbytes", name: "io_read_bytes", desc: "Bytes read"},
+		{key: "wbytes", name: "io_write_bytes", desc: "Bytes written"},
+		{key: "rios", name: "io_reads", desc: "Read operations"},
+		{key: "wios", name: "io_writes", desc: "Write operations"},
+	}
+)
+
+// Config is Cgroup configuration.
+type Config struct {
+	Enable   bool   `json:"enable" desc:"collect cgroup stats, when running under cgroup v2"`
+	Root     string `json:"cgroup_root" desc:"cgroup v2 mount point" default:"/sys/fs/cgroup"`
+	ProcRoot string `json:"procfs_root" desc:"procfs mount point, for locating our cgroup" default:"/proc"`
+}
+
+// Cgroup collects cgroup v2 stats.
+//
+// Files of controllers not enabled for the cgroup are skipped, as are limits of "max".
+type Cgroup struct {
+	Root     string
+	ProcRoot string
+}
+
+// New creates a Cgroup from Config.
+func (cfg *Config) New() *Cgroup {
+
+	return &Cgroup{
+		Root:     cfg.Root,
+		ProcRoot: cfg.ProcRoot,
+	}
+}
+
+// Collect collects stats.
+func (cg *Cgroup) Collect(ts time.Time) (pa entity.PointsAt, err error) {
+
+	pa = entity.PointsAt{
+		Name:   name,
+		Stamp:  ts,
+		Points: []entity.Point{},
+	}
+
+	dir, err := cg.dir()
+	if err != nil {
+		return
+	}
+
+	for _, collect := range []func(string) ([]entity.Point, error){memory, cpu, pids, io} {
+		var pts []entity.Point
+		pts, err = collect(dir)
+		if err != nil {
+			return
+		}
+		pa.Points = append(pa.Points, pts...)
+	}
+
+	return
+}
+
+// unexported
+
+type cpuStat struct {
+	key  string
+	name string
+	desc string
+	usec bool
+}
+
+type ioStat struct {
+	key  string
+	name string
+	desc string
+}
+
+func (cg *Cgroup) dir() (dir string, err error) {
+
+	// "0::/system.slice/stator.service", the v2 entry, alongside any v1 ones
+	// path is relative to the cgroup namespace, "/" inside most containers
+
+	file := filepath.Join(cg.ProcRoot, "self", "cgroup")
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read %s", file)
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		path, ok := strings.CutPrefix(scanner.Text(), "0::")
+		if !ok {
+			continue
+		}
+
+		dir = filepath.Join(cg.Root, path)
+
+		_, err = os.Stat(dir)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to find cgroup")
+		}
+		return
+	}
+
+	err = errors.Errorf("failed to find cgroup v2 entry in %s", file)
+	return
+}
+
+func read(dir, file string) (data string, ok bool, err error) {
+
+	path := filepath.Join(dir, file)
+
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read %s", path)
+		return
+	}
+
+	data = strings.TrimSpace(string(raw))
+	ok = true
+	return
+}
+
+func readUint(dir, file string) (val uint64, ok bool, err error) {
+
+	data, ok, err := read(dir, file)
+	if err != nil || !ok {
+		return
+	}
+
+	if data == unlimited {
+		ok = false
+		return
+	}
+
+	val, err = strconv.ParseUint(data, 10, 64)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to parse %s", file)
+	}
+	return
+}
+
+func memory(dir string) (pts []entity.Point, err error) {
+
+	current, ok, err := readUint(dir, "memory.current")
+	if err != nil {
+		return
+	}
+	if ok {
+		pts = append(pts, entity.Point{
+			Name:  "memory_current",
+			Desc:  "Memory in use by the cgroup and its descendants",
+			Unit:  "bytes",
+			Type:  "gauge",
+			Value: entity.Uint{Data: current},
+		})
+	}
+
+	max, ok, err := readUint(dir, "memory.max")
+	if err != nil {
+		return
+	}
+	if ok {
+		pts = append(pts, entity.Point{
+			Name:  "memory_max",
+			Desc:  "Memory limit of the cgroup",
+			Unit:  "bytes",
+			Type:  "gauge",
+			Value: entity.Uint{Data: max},
+		})
+	}
+
+	return
+}
+
+func cpu(dir string) (pts []entity.Point, err error) {
+
+	// cpu.max "50000 100000", quota and period in usec, quota "max" when unlimited
+	// cpu.stat "usage_usec 8123456" one per line
+
+	data, ok, err := read(dir, "cpu.max")
+	if err != nil {
+		return
+	}
+
+	fields := strings.Fields(data)
+	if ok && len(fields) == 2 && fields[0] != unlimited {
+		var quota, period uint64
+		quota, err = strconv.ParseUint(fields[0], 10, 64)
+		if err == nil {
+			period, err = strconv.ParseUint(fields[1], 10, 64)
+		}
+		if err != nil || period == 0 {
+			err = errors.Errorf("failed to parse cpu.max: %q", data)
+			return
+		}
+
+		pts = append(pts, entity.Point{
+			Name:  "cpu_limit",
+			Desc:  "Cpu quota of the cgroup, in cpus",
+			Type:  "gauge",
+			Value: entity.Float{Data: float64(quota) / float64(period)},
+		})
+	}
+
+	data, ok, err = read(dir, "cpu.stat")
+	if err != nil || !ok {
+		return
+	}
+
+	found := map[string]uint64{}
+	for _, line := range strings.Split(data, "\n") {
+		key, val, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+
+		found[key], err = strconv.ParseUint(strings.TrimSpace(val), 10, 64)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse cpu.stat %s", key)
+			return
+		}
+	}
+
+	for _, st := range cpuStats {
+		val, ok := found[st.key]
+		if !ok {
+			continue
+		}
+
+		var value entity.Value = entity.Uint{Data: val}
+		if st.usec {
+			value = entity.Float{Data: float64(val) / 1e6}
+		}
+
+		pts = append(pts, entity.Point{
+			Name:  st.name,
+			Desc:  st.desc,
+			Unit:  "total",
+			Type:  "counter",
+			Value: value,
+		})
+	}
+
+	return
+}
+
+func pids(dir string) (pts []entity.Point, err error) {
+
+	current, ok, err := readUint(dir, "pids.current")
+	if err != nil {
+		return
+	}
+	if ok {
+		pts = append(pts, entity.Point{
+			Name:  "pids",
+			Desc:  "Processes in the cgroup and its descendants",
+			Type:  "gauge",
+			Value: entity.Uint{Data: current},
+		})
+	}
+
+	max, ok, err := readUint(dir, "pids.max")
+	if err != nil {
+		return
+	}
+	if ok {
+		pts = append(pts, entity.Point{
+			Name:  "pids_max",
+			Desc:  "Process limit of the cgroup",
+			Type:  "gauge",
+			Value: entity.Uint{Data: max},
+		})
+	}
+
+	return
+}
+
+func io(dir string) (pts []entity.Point, err error) {
+
+	// "259:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0"
+
+	data, ok, err := read(dir, "io.stat")
+	if err != nil || !ok {
+		return
+	}
+
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		device := fields[0]
+
+		found := map[string]uint64{}
+		for _, field := range fields[1:] {
+			key, val, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+
+			found[key], err = strconv.ParseUint(val, 10, 64)
+			if err != nil {
+				err = errors.Wrapf(err, "failed to parse io.stat %s for %s", key, device)
+				return
+			}
+		}
+
+		labels := entity.Labels{{Key: "device", Val: device}}
+
+		for _, st := range ioStats {
+			val, ok := found[st.key]
+			if !ok {
+				continue
+			}
+
+			pts = append(pts, entity.Point{
+				Name:   st.name,
+				Desc:   st.desc,
+				Unit:   "total",
+				Type:   "counter",
+				Labels: labels,
+				Value:  entity.Uint{Data: val},
+			})
+		}
+	}
+
+	return
+}
@@ -0,0 +1,152 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"stator/entity"
+)
+
+func TestCgroup(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Cgroup Suite")
+}
+
+var _ = Describe("Cgroup", func() {
+	var (
+		cfg   *Config
+		cg    *Cgroup
+		stats entity.PointsAt
+		err   error
+	)
+
+	BeforeEach(func() {
+		cfg = &Config{
+			Root:     "testdata/cgroup",
+			ProcRoot: "testdata/proc",
+		}
+
+		cg = cfg.New()
+	})
+
+	Describe("creating a collector", func() {
+		It("creates one with roots", func() {
+			Expect(cg).To(Equal(&Cgroup{
+				Root:     "testdata/cgroup",
+				ProcRoot: "testdata/proc",
+			}))
+		})
+	})
+
+	Describe("collecting stats", func() {
+
+		JustBeforeEach(func() {
+			stats, err = cg.Collect(time.Time{})
+		})
+
+		When("all goes well", func() {
+			It("collects memory, cpu, pids and io, skipping unlimited", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stats.Name).To(Equal("cgroup"))
+
+				// 2 memory, 5 cpu, 1 pids, 2 devices x 4 io
+				Expect(stats.Points).To(HaveLen(16))
+
+				Expect(stats.Points[0]).To(Equal(entity.Point{
+					Name:  "memory_current",
+					Desc:  "Memory in use by the cgroup and its descendants",
+					Unit:  "bytes",
+					Type:  "gauge",
+					Value: entity.Uint{Data: 48234496},
+				}))
+				Expect(stats.Points[1].Name).To(Equal("memory_max"))
+				Expect(stats.Points[1].Value).To(Equal(entity.Uint{Data: 268435456}))
+
+				Expect(stats.Points[2]).To(Equal(entity.Point{
+					Name:  "cpu_limit",
+					Desc:  "Cpu quota of the cgroup, in cpus",
+					Type:  "gauge",
+					Value: entity.Float{Data: 0.5},
+				}))
+				Expect(stats.Points[3].Name).To(Equal("cpu_usage_seconds"))
+				Expect(stats.Points[3].Value).To(Equal(entity.Float{Data: 8.123456}))
+				Expect(stats.Points[5]).To(Equal(entity.Point{
+					Name:  "cpu_throttled_periods",
+					Desc:  "Enforcement periods in which the cgroup was throttled",
+					Unit:  "total",
+					Type:  "counter",
+					Value: entity.Uint{Data: 37},
+				}))
+				Expect(stats.Points[6].Value).To(Equal(entity.Float{Data: 0.912345}))
+
+				Expect(stats.Points[7].Name).To(Equal("pids"))
+				Expect(stats.Points[7].Value).To(Equal(entity.Uint{Data: 14}))
+
+				Expect(stats.Points[9]).To(Equal(entity.Point{
+					Name:   "io_write_bytes",
+					Desc:   "Bytes written",
+					Unit:   "total",
+					Type:   "counter",
+					Labels: entity.Labels{{Key: "device", Val: "259:0"}},
+					Value:  entity.Uint{Data: 314773504},
+				}))
+				Expect(stats.Points[12].Labels).To(Equal(entity.Labels{{Key: "device", Val: "253:0"}}))
+			})
+		})
+
+		When("controllers are not enabled", func() {
+			BeforeEach(func() {
+				cg.Root = GinkgoT().TempDir()
+				dir := filepath.Join(cg.Root, "system.slice", "stator.service")
+				Expect(os.MkdirAll(dir, 0o755)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(dir, "memory.current"), []byte("4096\n"), 0o644)).To(Succeed())
+			})
+
+			It("collects what's there", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stats.Points).To(HaveLen(1))
+				Expect(stats.Points[0].Name).To(Equal("memory_current"))
+			})
+		})
+
+		When("cpu.max is garbage", func() {
+			BeforeEach(func() {
+				cg.Root = GinkgoT().TempDir()
+				dir := filepath.Join(cg.Root, "system.slice", "stator.service")
+				Expect(os.MkdirAll(dir, 0o755)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(dir, "cpu.max"), []byte("bargle 100000\n"), 0o644)).To(Succeed())
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(`failed to parse cpu.max: "bargle 100000"`))
+			})
+		})
+
+		When("there is no cgroup v2 entry", func() {
+			BeforeEach(func() {
+				cg.ProcRoot = GinkgoT().TempDir()
+				Expect(os.Mkdir(filepath.Join(cg.ProcRoot, "self"), 0o755)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(cg.ProcRoot, "self", "cgroup"), []byte("4:memory:/stator\n"), 0o644)).To(Succeed())
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to find cgroup v2 entry")))
+			})
+		})
+
+		When("the cgroup directory is missing", func() {
+			BeforeEach(func() {
+				cg.Root = "testdata"
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to find cgroup")))
+			})
+		})
+	})
+})
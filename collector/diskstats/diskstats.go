@@ -0,0 +1,173 @@
+// Package diskstats collects per-device block I/O stats from Linux procfs.
+package diskstats
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"stator/collector/procfs"
+	"stator/entity"
+)
+
+const (
+	name = "diskstats"
+)
+
+// stats are picked out of the columns following the device name.
+var stats = []stat{
+	{col: 0, name: "reads", desc: "Reads completed", unit: "total", typ: "counter"},
+	{col: 2, name: "read_sectors", desc: "Sectors read, 512 bytes each", unit: "total", typ: "counter"},
+	{col: 3, name: "read_seconds", desc: "Time spent reading", unit: "total", typ: "counter", ms: true},
+	{col: 4, name: "writes", desc: "Writes completed", unit: "total", typ: "counter"},
+	{col: 6, name: "write_sectors", desc: "Sectors written, 512 bytes each", unit: "total", typ: "counter"},
+	{col: 7, name: "write_seconds", desc: "Time spent writing", unit: "total", typ: "counter", ms: true},
+	{col: 8, name: "io_in_progress", desc: "I/Os currently in progress", typ: "gauge"},
+	{col: 9, name: "io_seconds", desc: "Time spent doing I/Os", unit: "total", typ: "counter", ms: true},
+	{col: 10, name: "io_weighted_seconds", desc: "Time spent doing I/Os, weighted by those in progress", unit: "total", typ: "counter", ms: true},
+}
+
+// Config is DiskStats configuration.
+type Config struct {
+	Enable  bool     `json:"enable" desc:"collect block device stats, linux only"`
+	Root    string   `json:"procfs_root" desc:"procfs mount point" default:"/proc"`
+	Include []string `json:"include" desc:"device name patterns to collect, all when blank"`
+	Exclude []string `json:"exclude" desc:"device name patterns to skip, applied after include" default:"loop*,ram*"`
+	Paths   []string `json:"paths" desc:"filesystem paths to label their backing devices with, disk usage paths when blank"`
+}
+
+// DiskStats collects block device stats from procfs.
+type DiskStats struct {
+	Root   string
+	Filter procfs.Filter
+	Paths  []string
+}
+
+// New creates a DiskStats from Config.
+func (cfg *Config) New() *DiskStats {
+
+	return &DiskStats{
+		Root: cfg.Root,
+		Filter: procfs.Filter{
+			Include: cfg.Include,
+			Exclude: cfg.Exclude,
+		},
+		Paths: cfg.Paths,
+	}
+}
+
+// Collect collects stats.
+func (ds *DiskStats) Collect(ts time.Time) (pa entity.PointsAt, err error) {
+
+	// " 259       2 nvme0n1p2 281745 78272 22982546 71344 ..."
+
+	pa = entity.PointsAt{
+		Name:   name,
+		Stamp:  ts,
+		Points: []entity.Point{},
+	}
+
+	paths, err := ds.devicePaths()
+	if err != nil {
+		return
+	}
+
+	file := filepath.Join(ds.Root, "diskstats")
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read %s", file)
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 14 {
+			continue
+		}
+		device := fields[2]
+
+		var ok bool
+		ok, err = ds.Filter.Match(device)
+		if err != nil {
+			return
+		}
+		if !ok {
+			continue
+		}
+
+		labels := entity.Labels{{Key: "device", Val: device}}
+		if found, ok := paths[fields[0]+":"+fields[1]]; ok {
+			labels = append(labels, entity.Label{Key: "path", Val: strings.Join(found, ",")})
+		}
+
+		for _, st := range stats {
+			var val uint64
+			val, err = strconv.ParseUint(fields[st.col+3], 10, 64)
+			if err != nil {
+				err = errors.Wrapf(err, "failed to parse %s for %s", st.name, device)
+				return
+			}
+
+			var value entity.Value = entity.Uint{Data: val}
+			if st.ms {
+				value = entity.Float{Data: float64(val) / 1000}
+			}
+
+			pa.Points = append(pa.Points, entity.Point{
+				Name:   st.name,
+				Desc:   st.desc,
+				Unit:   st.unit,
+				Type:   st.typ,
+				Labels: labels,
+				Value:  value,
+			})
+		}
+	}
+
+	return
+}
+
+// unexported
+
+type stat struct {
+	col  int
+	name string
+	desc string
+	unit string
+	typ  string
+	ms   bool
+}
+
+func (ds *DiskStats) devicePaths() (paths map[string][]string, err error) {
+
+	// map "major:minor" to the paths residing on the device
+
+	paths = map[string][]string{}
+	if len(ds.Paths) == 0 {
+		return
+	}
+
+	mounts, err := procfs.ReadMounts(ds.Root)
+	if err != nil {
+		return
+	}
+
+	for _, path := range ds.Paths {
+		mount, ok := mounts.Find(path)
+		if !ok {
+			continue
+		}
+
+		paths[mount.Device()] = append(paths[mount.Device()], path)
+	}
+
+	return
+}
@@ -0,0 +1,133 @@
+package diskstats
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"stator/collector/procfs"
+	"stator/entity"
+)
+
+func TestDiskStats(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "DiskStats Suite")
+}
+
+var _ = Describe("DiskStats", func() {
+	var (
+		cfg   *Config
+		ds    *DiskStats
+		stats entity.PointsAt
+		err   error
+	)
+
+	BeforeEach(func() {
+		cfg = &Config{
+			Root:    "testdata/proc",
+			Exclude: []string{"loop*", "ram*"},
+			Paths:   []string{"/", "/var/lib/data", "/home"},
+		}
+
+		ds = cfg.New()
+	})
+
+	Describe("creating a collector", func() {
+		It("creates one with root, patterns and paths", func() {
+			Expect(ds).To(Equal(&DiskStats{
+				Root:   "testdata/proc",
+				Filter: procfs.Filter{Exclude: []string{"loop*", "ram*"}},
+				Paths:  []string{"/", "/var/lib/data", "/home"},
+			}))
+		})
+	})
+
+	Describe("collecting stats", func() {
+
+		JustBeforeEach(func() {
+			stats, err = ds.Collect(time.Time{})
+		})
+
+		When("all goes well", func() {
+			It("collects stats for all but excluded devices, labeled with paths", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stats.Name).To(Equal("diskstats"))
+
+				// 4 devices x 9 stats
+				Expect(stats.Points).To(HaveLen(36))
+
+				Expect(stats.Points[0]).To(Equal(entity.Point{
+					Name:   "reads",
+					Desc:   "Reads completed",
+					Unit:   "total",
+					Type:   "counter",
+					Labels: entity.Labels{{Key: "device", Val: "nvme0n1"}},
+					Value:  entity.Uint{Data: 284913},
+				}))
+				Expect(stats.Points[2].Name).To(Equal("read_seconds"))
+				Expect(stats.Points[2].Value).To(Equal(entity.Float{Data: 71.592}))
+
+				root := entity.Labels{{Key: "device", Val: "nvme0n1p2"}, {Key: "path", Val: "/,/home"}}
+				Expect(stats.Points[24]).To(Equal(entity.Point{
+					Name:   "io_in_progress",
+					Desc:   "I/Os currently in progress",
+					Type:   "gauge",
+					Labels: root,
+					Value:  entity.Uint{Data: 3},
+				}))
+				Expect(stats.Points[22].Name).To(Equal("write_sectors"))
+				Expect(stats.Points[22].Value).To(Equal(entity.Uint{Data: 41856280}))
+
+				Expect(stats.Points[27].Labels).To(Equal(entity.Labels{{Key: "device", Val: "dm-0"}, {Key: "path", Val: "/var/lib/data"}}))
+				Expect(stats.Points[35].Name).To(Equal("io_weighted_seconds"))
+				Expect(stats.Points[35].Value).To(Equal(entity.Float{Data: 31.134}))
+			})
+		})
+
+		When("including by pattern", func() {
+			BeforeEach(func() {
+				ds.Filter.Include = []string{"dm-*"}
+			})
+
+			It("collects only those included", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stats.Points).To(HaveLen(9))
+			})
+		})
+
+		When("mountinfo is missing", func() {
+			BeforeEach(func() {
+				ds.Root = "testdata"
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to read testdata/self/mountinfo")))
+			})
+		})
+
+		When("diskstats is missing and no paths", func() {
+			BeforeEach(func() {
+				ds.Root = "testdata"
+				ds.Paths = nil
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to read testdata/diskstats")))
+			})
+		})
+
+		When("running against the real procfs", func() {
+			BeforeEach(func() {
+				ds.Root = "/proc"
+				ds.Filter.Exclude = nil
+			})
+
+			It("collects something", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stats.Points).ToNot(BeEmpty())
+			})
+		})
+	})
+})
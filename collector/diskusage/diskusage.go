@@ -1,11 +1,14 @@
 package diskusage
 
 import (
+	"context"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
-	"golang.org/x/sys/unix"
 
+	"stator/collector/procfs"
 	"stator/entity"
 )
 
@@ -13,19 +16,69 @@ const (
 	name = "du"
 )
 
+//go:generate moq -out mock_test.go . Logger
+
+// Logger specifies a logger.
+type Logger interface {
+	Error(ctx context.Context, msg string, err error, kv ...any)
+}
+
 type Config struct {
-	Paths []string `json:"paths" desc:"filesystem paths to collect usage stats" default:"/"`
+	Paths        []string      `json:"paths" desc:"filesystem paths to collect usage stats" default:"/"`
+	Root         string        `json:"procfs_root" desc:"procfs mount point, for mountinfo" default:"/proc"`
+	Discover     bool          `json:"discover" desc:"also collect for mounts found in mountinfo"`
+	FsInclude    []string      `json:"fstype_include" desc:"filesystem types to discover, all when blank"`
+	FsExclude    []string      `json:"fstype_exclude" desc:"filesystem types not to discover" default:"autofs,binfmt_misc,bpf,cgroup,cgroup2,configfs,debugfs,devpts,devtmpfs,fusectl,hugetlbfs,mqueue,nsfs,overlay,proc,pstore,securityfs,squashfs,sysfs,tmpfs,tracefs"`
+	MountInclude []string      `json:"mount_include" desc:"mount point patterns to discover, with those beneath, all when blank"`
+	MountExclude []string      `json:"mount_exclude" desc:"mount point patterns not to discover, with those beneath" default:"/dev,/proc,/run,/sys"`
+	Refresh      time.Duration `json:"refresh" desc:"interval at which mountinfo is re-read" default:"5m"`
 }
 
 // DiskUsage collects disk usage stats.
+//
+// Mounts are read from mountinfo for labels and, when discovering, for paths, at most
+// once per refresh interval. Bind mounts of a device already collected are skipped.
+// Should mountinfo be unreadable, collection carries on with the mounts last read, if
+// any, otherwise with Paths alone and fstype from statfs.
+// A discovered mount that cannot be statted, such as a stale nfs or unreadable fuse
+// mount, is logged and skipped, while one among Paths fails collection.
+// Usage is from statfs, supported on linux, darwin and freebsd.
 type DiskUsage struct {
-	Paths []string
+	Logger      Logger
+	Paths       []string
+	Root        string
+	Discover    bool
+	FsTypes     procfs.Filter
+	MountPoints procfs.Filter
+	Refresh     time.Duration
+
+	statfs func(path string) (st fsStat, err error)
+
+	mu         sync.Mutex
+	mounts     procfs.Mounts
+	discovered []string
+	read       bool
+	readAt     time.Time
 }
 
-func (cfg *Config) New() *DiskUsage {
+func (cfg *Config) New(lgr Logger) *DiskUsage {
 
 	return &DiskUsage{
-		Paths: cfg.Paths,
+		Logger:   lgr,
+		Paths:    cfg.Paths,
+		Root:     cfg.Root,
+		Discover: cfg.Discover,
+		FsTypes: procfs.Filter{
+			Include: cfg.FsInclude,
+			Exclude: cfg.FsExclude,
+		},
+		MountPoints: procfs.Filter{
+			Include: cfg.MountInclude,
+			Exclude: cfg.MountExclude,
+			Prefix:  true,
+		},
+		Refresh: cfg.Refresh,
+		statfs:  statfs,
 	}
 }
 
@@ -38,17 +91,39 @@ func (du *DiskUsage) Collect(ts time.Time) (pa entity.PointsAt, err error) {
 		Points: []entity.Point{},
 	}
 
-	for _, path := range du.Paths {
+	mounts, paths, err := du.mountsAt(ts)
+	if err != nil {
+		return
+	}
+
+	for i, path := range paths {
 
-		var size, avail uint64
-		var used float64
+		// paths lead with those configured, followed by any discovered
 
-		size, avail, used, err = duStats(path)
+		var use usage
+		use, err = du.duStats(path)
 		if err != nil {
-			return
+			if i < len(du.Paths) {
+				return
+			}
+
+			du.Logger.Error(context.Background(), "skipping discovered mount", err, "path", path)
+			err = nil
+			continue
 		}
 
-		labels := entity.Labels{{Key: "path", Val: path}}
+		mount, _ := mounts.Find(path)
+
+		fsType := mount.FsType
+		if fsType == "" {
+			fsType = use.fsType
+		}
+
+		labels := entity.Labels{
+			{Key: "path", Val: path},
+			{Key: "fstype", Val: fsType},
+			{Key: "device", Val: mount.Source},
+		}
 
 		pa.Points = append(pa.Points, []entity.Point{
 			{
@@ -57,7 +132,7 @@ func (du *DiskUsage) Collect(ts time.Time) (pa entity.PointsAt, err error) {
 				Unit:   "bytes",
 				Type:   "gauge",
 				Labels: labels,
-				Value:  entity.Uint{Data: size},
+				Value:  entity.Uint{Data: use.size},
 			},
 			{
 				Name:   "available",
@@ -65,7 +140,7 @@ func (du *DiskUsage) Collect(ts time.Time) (pa entity.PointsAt, err error) {
 				Unit:   "bytes",
 				Type:   "gauge",
 				Labels: labels,
-				Value:  entity.Uint{Data: avail},
+				Value:  entity.Uint{Data: use.avail},
 			},
 			{
 				Name:   "used",
@@ -73,7 +148,36 @@ func (du *DiskUsage) Collect(ts time.Time) (pa entity.PointsAt, err error) {
 				Unit:   "percent",
 				Type:   "gauge",
 				Labels: labels,
-				Value:  entity.Float{Data: used},
+				Value:  entity.Float{Data: use.used},
+			},
+			{
+				Name:   "inodes",
+				Desc:   "Total inodes on the filesystem",
+				Type:   "gauge",
+				Labels: labels,
+				Value:  entity.Uint{Data: use.inodes},
+			},
+			{
+				Name:   "inodes_free",
+				Desc:   "Free inodes on the filesystem",
+				Type:   "gauge",
+				Labels: labels,
+				Value:  entity.Uint{Data: use.inodesFree},
+			},
+			{
+				Name:   "inodes_used",
+				Desc:   "Percentage of inodes on the filesystem in use",
+				Unit:   "percent",
+				Type:   "gauge",
+				Labels: labels,
+				Value:  entity.Float{Data: use.inodesUsed},
+			},
+			{
+				Name:   "readonly",
+				Desc:   "Whether the filesystem is mounted read-only",
+				Type:   "gauge",
+				Labels: labels,
+				Value:  entity.Uint{Data: use.readonly},
 			},
 		}...)
 	}
@@ -83,22 +187,127 @@ func (du *DiskUsage) Collect(ts time.Time) (pa entity.PointsAt, err error) {
 
 // unexported
 
-func duStats(path string) (size, avail uint64, used float64, err error) {
+type usage struct {
+	size       uint64
+	avail      uint64
+	used       float64
+	inodes     uint64
+	inodesFree uint64
+	inodesUsed float64
+	readonly   uint64
+	fsType     string
+}
+
+// fsStat is the platform independent subset of statfs used here.
+type fsStat struct {
+	bsize    uint64
+	blocks   uint64
+	bfree    uint64
+	bavail   uint64
+	files    uint64
+	ffree    uint64
+	readonly bool
+	fsType   string
+}
+
+func (du *DiskUsage) mountsAt(ts time.Time) (mounts procfs.Mounts, paths []string, err error) {
+
+	du.mu.Lock()
+	defer du.mu.Unlock()
 
-	fs := &unix.Statfs_t{}
-	err = unix.Statfs(path, fs)
+	if !du.read || ts.Sub(du.readAt) >= du.Refresh {
+		var rmErr error
+		mounts, rmErr = procfs.ReadMounts(du.Root)
+
+		// mountinfo is a nicety, absent on other platforms and in some containers,
+		// so carry on without it until the next refresh
+
+		if rmErr == nil {
+			var discovered []string
+			discovered, err = du.discover(mounts)
+			if err != nil {
+				return
+			}
+
+			du.mounts = mounts
+			du.discovered = discovered
+		}
+
+		du.read = true
+		du.readAt = ts
+	}
+
+	mounts = du.mounts
+	paths = append(append([]string{}, du.Paths...), du.discovered...)
+	return
+}
+
+func (du *DiskUsage) discover(mounts procfs.Mounts) (paths []string, err error) {
+
+	if !du.Discover {
+		return
+	}
+
+	listed := map[string]bool{}
+	for _, path := range du.Paths {
+		listed[filepath.Clean(path)] = true
+	}
+	devices := map[string]bool{}
+
+	for _, mount := range mounts {
+		var ok bool
+		ok, err = du.FsTypes.Match(mount.FsType)
+		if err != nil {
+			return
+		}
+		if !ok {
+			continue
+		}
+
+		ok, err = du.MountPoints.Match(mount.MountPoint)
+		if err != nil {
+			return
+		}
+		if !ok || devices[mount.Device()] {
+			continue
+		}
+		devices[mount.Device()] = true
+
+		if listed[mount.MountPoint] {
+			continue
+		}
+		paths = append(paths, mount.MountPoint)
+	}
+
+	return
+}
+
+func (du *DiskUsage) duStats(path string) (use usage, err error) {
+
+	fs, err := du.statfs(path)
 	if err != nil {
 		err = errors.Wrapf(err, "failed to get disk usage for %s", path)
 		return
 	}
 
-	bs := uint64(fs.Bsize)
-	size = fs.Blocks * bs
-	avail = fs.Bavail * bs
+	use.size = fs.blocks * fs.bsize
+	use.avail = fs.bavail * fs.bsize
 
-	reserved := fs.Bfree - fs.Bavail
-	total := (fs.Blocks - reserved) * bs
-	used = float64(total-avail) * 100 / float64(total)
+	reserved := fs.bfree - fs.bavail
+	total := (fs.blocks - reserved) * fs.bsize
+	use.used = float64(total-use.avail) * 100 / float64(total)
+
+	// some filesystems, btrfs for one, allocate inodes dynamically and report none
+	use.inodes = fs.files
+	use.inodesFree = fs.ffree
+	if fs.files > 0 {
+		use.inodesUsed = float64(fs.files-fs.ffree) * 100 / float64(fs.files)
+	}
+
+	if fs.readonly {
+		use.readonly = 1
+	}
 
+	use.fsType = fs.fsType
 	return
 }
@@ -0,0 +1,50 @@
+package diskusage
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// fsTypes names filesystems by magic number, for those not found in mountinfo.
+var fsTypes = map[int64]string{
+	0x9123683e: "btrfs",
+	0x00c36400: "ceph",
+	0xff534d42: "cifs",
+	0x0000ef53: "ext4",
+	0xf2f52010: "f2fs",
+	0x65735546: "fuse",
+	0x00006969: "nfs",
+	0x794c7630: "overlay",
+	0x73717368: "squashfs",
+	0x01021994: "tmpfs",
+	0x00004d44: "vfat",
+	0x58465342: "xfs",
+	0x2fc12fc1: "zfs",
+}
+
+func statfs(path string) (st fsStat, err error) {
+
+	fs := &unix.Statfs_t{}
+	err = unix.Statfs(path, fs)
+	if err != nil {
+		return
+	}
+
+	st = fsStat{
+		bsize:    uint64(fs.Bsize),
+		blocks:   fs.Blocks,
+		bfree:    fs.Bfree,
+		bavail:   fs.Bavail,
+		files:    fs.Files,
+		ffree:    fs.Ffree,
+		readonly: fs.Flags&unix.ST_RDONLY != 0,
+		fsType:   fsTypes[int64(fs.Type)],
+	}
+
+	if st.fsType == "" {
+		st.fsType = fmt.Sprintf("0x%x", fs.Type)
+	}
+
+	return
+}
@@ -0,0 +1,32 @@
+//go:build darwin || freebsd
+
+package diskusage
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+func statfs(path string) (st fsStat, err error) {
+
+	fs := &unix.Statfs_t{}
+	err = unix.Statfs(path, fs)
+	if err != nil {
+		return
+	}
+
+	// field widths and signedness vary by platform, freebsd's bavail and ffree
+	// going negative when root has dipped into the reserve
+
+	st = fsStat{
+		bsize:    uint64(fs.Bsize),
+		blocks:   uint64(fs.Blocks),
+		bfree:    uint64(fs.Bfree),
+		bavail:   uint64(max(int64(fs.Bavail), 0)),
+		files:    uint64(fs.Files),
+		ffree:    uint64(max(int64(fs.Ffree), 0)),
+		readonly: uint64(fs.Flags)&unix.MNT_RDONLY != 0,
+		fsType:   unix.ByteSliceToString(fs.Fstypename[:]),
+	}
+
+	return
+}
@@ -1,12 +1,15 @@
 package diskusage
 
 import (
+	"context"
+	"fmt"
 	"testing"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"stator/collector/procfs"
 	"stator/entity"
 )
 
@@ -18,6 +21,7 @@ func TestDiskUsage(t *testing.T) {
 var _ = Describe("DiskUsage", func() {
 	var (
 		cfg   *Config
+		lgr   *LoggerMock
 		du    *DiskUsage
 		stats entity.PointsAt
 		err   error
@@ -25,17 +29,26 @@ var _ = Describe("DiskUsage", func() {
 
 	BeforeEach(func() {
 		cfg = &Config{
-			Paths: []string{"/"},
+			Paths:        []string{"/"},
+			Root:         "/proc",
+			FsExclude:    []string{"tmpfs"},
+			MountInclude: []string{"/data*"},
 		}
 
-		du = cfg.New()
+		lgr = &LoggerMock{
+			ErrorFunc: func(ctx context.Context, msg string, err error, kv ...any) {},
+		}
+
+		du = cfg.New(lgr)
 	})
 
 	Describe("creating a collector", func() {
 		It("collects stats", func() {
-			Expect(du).To(Equal(&DiskUsage{
-				Paths: []string{"/"},
-			}))
+			Expect(du.Paths).To(Equal([]string{"/"}))
+			Expect(du.Root).To(Equal("/proc"))
+			Expect(du.FsTypes).To(Equal(procfs.Filter{Exclude: []string{"tmpfs"}}))
+			Expect(du.MountPoints).To(Equal(procfs.Filter{Include: []string{"/data*"}, Prefix: true}))
+			Expect(du.statfs).ToNot(BeNil())
 		})
 	})
 
@@ -49,7 +62,243 @@ var _ = Describe("DiskUsage", func() {
 			It("collects stats", func() {
 				Expect(err).ToNot(HaveOccurred())
 				Expect(stats.Name).To(Equal("du"))
-				Expect(stats.Points).To(HaveLen(3))
+				Expect(stats.Points).To(HaveLen(7))
+				Expect(stats.Points[0].Labels[0]).To(Equal(entity.Label{Key: "path", Val: "/"}))
+				Expect(stats.Points[0].Labels[1].Key).To(Equal("fstype"))
+				Expect(stats.Points[0].Labels[1].Val).ToNot(BeEmpty())
+			})
+		})
+
+		When("statfs is faked", func() {
+			BeforeEach(func() {
+				du.Root = "testdata/proc"
+				du.Paths = []string{"/var/lib/data/db", "/srv"}
+				du.statfs = func(path string) (fsStat, error) {
+					return fsStat{
+						bsize:    4096,
+						blocks:   1000,
+						bfree:    250,
+						bavail:   250,
+						files:    400,
+						ffree:    100,
+						readonly: true,
+						fsType:   "xfs",
+					}, nil
+				}
+			})
+
+			It("collects inode stats, readonly and labels from mountinfo", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stats.Points).To(HaveLen(14))
+
+				labels := entity.Labels{
+					{Key: "path", Val: "/var/lib/data/db"},
+					{Key: "fstype", Val: "xfs"},
+					{Key: "device", Val: "/dev/mapper/vg0-data"},
+				}
+				Expect(stats.Points[2].Value).To(Equal(entity.Float{Data: 75}))
+				Expect(stats.Points[3]).To(Equal(entity.Point{
+					Name:   "inodes",
+					Desc:   "Total inodes on the filesystem",
+					Type:   "gauge",
+					Labels: labels,
+					Value:  entity.Uint{Data: 400},
+				}))
+				Expect(stats.Points[4].Value).To(Equal(entity.Uint{Data: 100}))
+				Expect(stats.Points[5].Name).To(Equal("inodes_used"))
+				Expect(stats.Points[5].Value).To(Equal(entity.Float{Data: 75}))
+				Expect(stats.Points[6].Name).To(Equal("readonly"))
+				Expect(stats.Points[6].Value).To(Equal(entity.Uint{Data: 1}))
+
+				Expect(stats.Points[7].Labels).To(Equal(entity.Labels{
+					{Key: "path", Val: "/srv"},
+					{Key: "fstype", Val: "ext4"},
+					{Key: "device", Val: "/dev/nvme0n1p2"},
+				}))
+			})
+
+			When("filesystem reports no inodes and is not in mountinfo", func() {
+				BeforeEach(func() {
+					du.Root = "/proc"
+					du.Paths = []string{"bargle"}
+					statfs := du.statfs
+					du.statfs = func(path string) (fs fsStat, err error) {
+						fs, err = statfs(path)
+						fs.files, fs.ffree, fs.readonly, fs.fsType = 0, 0, false, "btrfs"
+						return
+					}
+				})
+
+				It("reports zero inodes used and fstype from statfs", func() {
+					Expect(err).ToNot(HaveOccurred())
+					Expect(stats.Points[5].Value).To(Equal(entity.Float{Data: 0}))
+					Expect(stats.Points[6].Value).To(Equal(entity.Uint{Data: 0}))
+					Expect(stats.Points[0].Labels).To(Equal(entity.Labels{
+						{Key: "path", Val: "bargle"},
+						{Key: "fstype", Val: "btrfs"},
+						{Key: "device", Val: ""},
+					}))
+				})
+			})
+		})
+
+		When("discovering mounts", func() {
+			var (
+				paths func() []string
+			)
+
+			BeforeEach(func() {
+				du.Root = "testdata/proc"
+				du.Discover = true
+				du.FsTypes = procfs.Filter{Exclude: []string{"proc", "sysfs", "tmpfs"}}
+				du.MountPoints = procfs.Filter{}
+				du.Refresh = 5 * time.Minute
+				du.statfs = func(path string) (fsStat, error) {
+					return fsStat{bsize: 4096, blocks: 1000, bfree: 250, bavail: 250}, nil
+				}
+
+				paths = func() (found []string) {
+					for i := 0; i < len(stats.Points); i += 7 {
+						found = append(found, stats.Points[i].Labels[0].Val)
+					}
+					return
+				}
+			})
+
+			It("adds mounts not excluded, once per device", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(paths()).To(Equal([]string{"/", "/boot/efi", "/var/lib/data"}))
+			})
+
+			When("filtering by mount point", func() {
+				BeforeEach(func() {
+					du.Paths = nil
+					du.MountPoints = procfs.Filter{Include: []string{"/var/*/*", "/srv/*"}}
+				})
+
+				It("adds only those included", func() {
+					Expect(err).ToNot(HaveOccurred())
+					Expect(paths()).To(Equal([]string{"/var/lib/data"}))
+				})
+			})
+
+			When("excluding a mount point", func() {
+				BeforeEach(func() {
+					du.MountPoints = procfs.Filter{Exclude: []string{"/var"}, Prefix: true}
+				})
+
+				It("skips mounts beneath it as well", func() {
+					Expect(err).ToNot(HaveOccurred())
+					Expect(paths()).To(Equal([]string{"/", "/boot/efi", "/srv/db"}))
+				})
+			})
+
+			When("a discovered mount cannot be statted", func() {
+				BeforeEach(func() {
+					statfs := du.statfs
+					du.statfs = func(path string) (fs fsStat, err error) {
+						if path == "/boot/efi" {
+							err = fmt.Errorf("stale file handle")
+							return
+						}
+						return statfs(path)
+					}
+				})
+
+				It("logs and skips it, collecting the rest", func() {
+					Expect(err).ToNot(HaveOccurred())
+					Expect(paths()).To(Equal([]string{"/", "/var/lib/data"}))
+
+					ec := lgr.ErrorCalls()
+					Expect(ec).To(HaveLen(1))
+					Expect(ec[0].Msg).To(Equal("skipping discovered mount"))
+					Expect(ec[0].Err).To(MatchError(ContainSubstring("stale file handle")))
+					Expect(ec[0].Kv).To(Equal([]any{"path", "/boot/efi"}))
+				})
+			})
+
+			When("a configured path cannot be statted", func() {
+				BeforeEach(func() {
+					du.statfs = func(path string) (fs fsStat, err error) {
+						err = fmt.Errorf("stale file handle")
+						return
+					}
+				})
+
+				It("returns error", func() {
+					Expect(err).To(MatchError(ContainSubstring("failed to get disk usage for /")))
+					Expect(lgr.ErrorCalls()).To(BeEmpty())
+				})
+			})
+
+			When("a pattern is malformed", func() {
+				BeforeEach(func() {
+					du.FsTypes.Exclude = []string{"tmp["}
+				})
+
+				It("returns error", func() {
+					Expect(err).To(MatchError(ContainSubstring(`failed to match pattern "tmp["`)))
+				})
+			})
+
+			When("collecting again", func() {
+				var (
+					stamp time.Time
+				)
+
+				BeforeEach(func() {
+					stamp = time.Time{}.Add(time.Minute)
+				})
+
+				JustBeforeEach(func() {
+					Expect(err).ToNot(HaveOccurred())
+
+					du.Root = "testdata"
+					stats, err = du.Collect(stamp)
+				})
+
+				When("within the refresh interval", func() {
+					It("uses the cached mounts", func() {
+						Expect(err).ToNot(HaveOccurred())
+						Expect(paths()).To(Equal([]string{"/", "/boot/efi", "/var/lib/data"}))
+					})
+				})
+
+				When("after the refresh interval", func() {
+					BeforeEach(func() {
+						stamp = time.Time{}.Add(5 * time.Minute)
+					})
+
+					It("carries on with the mounts last read when mountinfo is gone", func() {
+						Expect(err).ToNot(HaveOccurred())
+						Expect(paths()).To(Equal([]string{"/", "/boot/efi", "/var/lib/data"}))
+						Expect(stats.Points[14].Labels[2]).To(Equal(entity.Label{Key: "device", Val: "/dev/mapper/vg0-data"}))
+					})
+				})
+			})
+		})
+
+		When("mountinfo is missing", func() {
+			BeforeEach(func() {
+				du.Root = "testdata"
+			})
+
+			It("collects paths without device, fstype from statfs", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stats.Points).To(HaveLen(7))
+				Expect(stats.Points[0].Labels[1].Val).ToNot(BeEmpty())
+				Expect(stats.Points[0].Labels[2]).To(Equal(entity.Label{Key: "device", Val: ""}))
+			})
+
+			When("discovering", func() {
+				BeforeEach(func() {
+					du.Discover = true
+				})
+
+				It("still collects paths", func() {
+					Expect(err).ToNot(HaveOccurred())
+					Expect(stats.Points).To(HaveLen(7))
+				})
 			})
 		})
 
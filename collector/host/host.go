@@ -0,0 +1,236 @@
+// Package host collects cpu, memory and load stats from Linux procfs.
+package host
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"stator/collector/procfs"
+	"stator/entity"
+)
+
+const (
+	name = "host"
+)
+
+var (
+	cpuModes = []string{"user", "nice", "system", "idle", "iowait", "irq", "softirq", "steal"}
+
+	memFields = []memField{
+		{key: "MemTotal", name: "mem_total", desc: "Total usable memory"},
+		{key: "MemFree", name: "mem_free", desc: "Memory not in use at all"},
+		{key: "MemAvailable", name: "mem_available", desc: "Memory available for starting new applications without swapping"},
+		{key: "Buffers", name: "mem_buffers", desc: "Memory in raw disk block buffers"},
+		{key: "Cached", name: "mem_cached", desc: "Memory in the page cache"},
+		{key: "SwapTotal", name: "swap_total", desc: "Total swap space"},
+		{key: "SwapFree", name: "swap_free", desc: "Unused swap space"},
+	}
+
+	loads = []load{
+		{name: "load1", desc: "Load average over the last minute"},
+		{name: "load5", desc: "Load average over the last 5 minutes"},
+		{name: "load15", desc: "Load average over the last 15 minutes"},
+	}
+)
+
+// Config is Host configuration.
+type Config struct {
+	Enable bool   `json:"enable" desc:"collect host stats, linux only"`
+	Root   string `json:"procfs_root" desc:"procfs mount point" default:"/proc"`
+}
+
+// Host collects host stats from procfs.
+type Host struct {
+	Root string
+}
+
+// New creates a Host from Config.
+func (cfg *Config) New() *Host {
+
+	return &Host{
+		Root: cfg.Root,
+	}
+}
+
+// Collect collects stats.
+func (host *Host) Collect(ts time.Time) (pa entity.PointsAt, err error) {
+
+	pa = entity.PointsAt{
+		Name:   name,
+		Stamp:  ts,
+		Points: []entity.Point{},
+	}
+
+	for _, collect := range []func() ([]entity.Point, error){host.cpu, host.memory, host.load} {
+		var pts []entity.Point
+		pts, err = collect()
+		if err != nil {
+			return
+		}
+		pa.Points = append(pa.Points, pts...)
+	}
+
+	return
+}
+
+// unexported
+
+type memField struct {
+	key  string
+	name string
+	desc string
+}
+
+type load struct {
+	name string
+	desc string
+}
+
+func (host *Host) read(file string) (data []byte, err error) {
+
+	path := filepath.Join(host.Root, file)
+
+	data, err = os.ReadFile(path)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read %s", path)
+	}
+	return
+}
+
+func (host *Host) cpu() (pts []entity.Point, err error) {
+
+	// per-cpu lines only, "cpu0 4705 356 584 ..." in ticks, skipping the aggregate "cpu" line
+
+	data, err := host.read("stat")
+	if err != nil {
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "cpu") || fields[0] == "cpu" {
+			continue
+		}
+		cpu := strings.TrimPrefix(fields[0], "cpu")
+
+		for i, mode := range cpuModes {
+			if i+1 >= len(fields) {
+				break
+			}
+
+			var ticks uint64
+			ticks, err = strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				err = errors.Wrapf(err, "failed to parse %s ticks for cpu %s", mode, cpu)
+				return
+			}
+
+			pts = append(pts, entity.Point{
+				Name:   "cpu_seconds",
+				Desc:   "Seconds the cpus spent in each mode",
+				Unit:   "total",
+				Type:   "counter",
+				Labels: entity.Labels{{Key: "cpu", Val: cpu}, {Key: "mode", Val: mode}},
+				Value:  entity.Float{Data: float64(ticks) / procfs.UserHz},
+			})
+		}
+	}
+
+	return
+}
+
+func (host *Host) memory() (pts []entity.Point, err error) {
+
+	// "MemTotal:       16303428 kB"
+
+	data, err := host.read("meminfo")
+	if err != nil {
+		return
+	}
+
+	found := map[string]uint64{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var val uint64
+		val, err = strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse meminfo %s", key)
+			return
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			val *= 1024
+		}
+
+		found[key] = val
+	}
+
+	for _, mf := range memFields {
+		val, ok := found[mf.key]
+		if !ok {
+			continue
+		}
+
+		pts = append(pts, entity.Point{
+			Name:  mf.name,
+			Desc:  mf.desc,
+			Unit:  "bytes",
+			Type:  "gauge",
+			Value: entity.Uint{Data: val},
+		})
+	}
+
+	return
+}
+
+func (host *Host) load() (pts []entity.Point, err error) {
+
+	// "0.42 0.36 0.31 2/1013 42871"
+
+	data, err := host.read("loadavg")
+	if err != nil {
+		return
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < len(loads) {
+		err = errors.Errorf("failed to parse loadavg, too few fields: %q", data)
+		return
+	}
+
+	for i, ld := range loads {
+		var val float64
+		val, err = strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse %s", ld.name)
+			return
+		}
+
+		pts = append(pts, entity.Point{
+			Name:  ld.name,
+			Desc:  ld.desc,
+			Type:  "gauge",
+			Value: entity.Float{Data: val},
+		})
+	}
+
+	return
+}
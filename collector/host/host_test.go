@@ -0,0 +1,127 @@
+package host
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"stator/entity"
+)
+
+func TestHost(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Host Suite")
+}
+
+var _ = Describe("Host", func() {
+	var (
+		cfg   *Config
+		host  *Host
+		stats entity.PointsAt
+		err   error
+	)
+
+	BeforeEach(func() {
+		cfg = &Config{
+			Root: "testdata/proc",
+		}
+
+		host = cfg.New()
+	})
+
+	Describe("creating a collector", func() {
+		It("creates one with root", func() {
+			Expect(host).To(Equal(&Host{
+				Root: "testdata/proc",
+			}))
+		})
+	})
+
+	Describe("collecting stats", func() {
+
+		JustBeforeEach(func() {
+			stats, err = host.Collect(time.Time{})
+		})
+
+		When("all goes well", func() {
+			It("collects cpu, memory and load", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stats.Name).To(Equal("host"))
+
+				// 2 cpus x 8 modes, 7 memory, 3 load
+				Expect(stats.Points).To(HaveLen(26))
+
+				Expect(stats.Points[0]).To(Equal(entity.Point{
+					Name:   "cpu_seconds",
+					Desc:   "Seconds the cpus spent in each mode",
+					Unit:   "total",
+					Type:   "counter",
+					Labels: entity.Labels{{Key: "cpu", Val: "0"}, {Key: "mode", Val: "user"}},
+					Value:  entity.Float{Data: 13.93},
+				}))
+				Expect(stats.Points[11].Labels).To(Equal(entity.Labels{{Key: "cpu", Val: "1"}, {Key: "mode", Val: "idle"}}))
+				Expect(stats.Points[11].Value).To(Equal(entity.Float{Data: 19.16}))
+
+				Expect(stats.Points[18]).To(Equal(entity.Point{
+					Name:  "mem_available",
+					Desc:  "Memory available for starting new applications without swapping",
+					Unit:  "bytes",
+					Type:  "gauge",
+					Value: entity.Uint{Data: 11422364 * 1024},
+				}))
+				Expect(stats.Points[22].Name).To(Equal("swap_free"))
+
+				Expect(stats.Points[23]).To(Equal(entity.Point{
+					Name:  "load1",
+					Desc:  "Load average over the last minute",
+					Type:  "gauge",
+					Value: entity.Float{Data: 0.42},
+				}))
+				Expect(stats.Points[25].Value).To(Equal(entity.Float{Data: 0.31}))
+			})
+		})
+
+		When("running against the real procfs", func() {
+			BeforeEach(func() {
+				host.Root = "/proc"
+			})
+
+			It("collects something", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(len(stats.Points)).To(BeNumerically(">", 10))
+			})
+		})
+
+		When("a file is missing", func() {
+			BeforeEach(func() {
+				host.Root = "testdata"
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to read testdata/stat")))
+			})
+		})
+
+		When("loadavg is garbage", func() {
+			BeforeEach(func() {
+				root := GinkgoT().TempDir()
+				for _, file := range []string{"stat", "meminfo"} {
+					data, err := os.ReadFile(filepath.Join("testdata/proc", file))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(os.WriteFile(filepath.Join(root, file), data, 0o644)).To(Succeed())
+				}
+				Expect(os.WriteFile(filepath.Join(root, "loadavg"), []byte("0.42 bargle 0.31 2/1013 42871\n"), 0o644)).To(Succeed())
+
+				host.Root = root
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to parse load5")))
+			})
+		})
+	})
+})
@@ -0,0 +1,133 @@
+// Package netdev collects per-interface network stats from Linux procfs.
+package netdev
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"stator/collector/procfs"
+	"stator/entity"
+)
+
+const (
+	name = "netdev"
+)
+
+// counters are picked out of the 16 columns following the interface name,
+// receive in the first eight and transmit in the last.
+var counters = []counter{
+	{col: 0, name: "rx_bytes", desc: "Bytes received"},
+	{col: 1, name: "rx_packets", desc: "Packets received"},
+	{col: 2, name: "rx_errors", desc: "Receive errors detected by the driver"},
+	{col: 3, name: "rx_drops", desc: "Received packets dropped"},
+	{col: 8, name: "tx_bytes", desc: "Bytes transmitted"},
+	{col: 9, name: "tx_packets", desc: "Packets transmitted"},
+	{col: 10, name: "tx_errors", desc: "Transmit errors detected by the driver"},
+	{col: 11, name: "tx_drops", desc: "Transmitted packets dropped"},
+}
+
+// Config is NetDev configuration.
+type Config struct {
+	Enable  bool     `json:"enable" desc:"collect network interface stats, linux only"`
+	Root    string   `json:"procfs_root" desc:"procfs mount point" default:"/proc"`
+	Include []string `json:"include" desc:"interface name patterns to collect, all when blank"`
+	Exclude []string `json:"exclude" desc:"interface name patterns to skip, applied after include" default:"lo"`
+}
+
+// NetDev collects network interface stats from procfs.
+type NetDev struct {
+	Root   string
+	Filter procfs.Filter
+}
+
+// New creates a NetDev from Config.
+func (cfg *Config) New() *NetDev {
+
+	return &NetDev{
+		Root: cfg.Root,
+		Filter: procfs.Filter{
+			Include: cfg.Include,
+			Exclude: cfg.Exclude,
+		},
+	}
+}
+
+// Collect collects stats.
+func (nd *NetDev) Collect(ts time.Time) (pa entity.PointsAt, err error) {
+
+	// "  eth0: 1894730211 1652110    3   17    0 ..."
+
+	pa = entity.PointsAt{
+		Name:   name,
+		Stamp:  ts,
+		Points: []entity.Point{},
+	}
+
+	file := filepath.Join(nd.Root, "net", "dev")
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read %s", file)
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		iface, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		iface = strings.TrimSpace(iface)
+
+		ok, err = nd.Filter.Match(iface)
+		if err != nil {
+			return
+		}
+		if !ok {
+			continue
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) < 16 {
+			err = errors.Errorf("failed to parse %s, too few fields for %s: %d", file, iface, len(fields))
+			return
+		}
+
+		labels := entity.Labels{{Key: "device", Val: iface}}
+
+		for _, ctr := range counters {
+			var val uint64
+			val, err = strconv.ParseUint(fields[ctr.col], 10, 64)
+			if err != nil {
+				err = errors.Wrapf(err, "failed to parse %s for %s", ctr.name, iface)
+				return
+			}
+
+			pa.Points = append(pa.Points, entity.Point{
+				Name:   ctr.name,
+				Desc:   ctr.desc,
+				Unit:   "total",
+				Type:   "counter",
+				Labels: labels,
+				Value:  entity.Uint{Data: val},
+			})
+		}
+	}
+
+	return
+}
+
+// unexported
+
+type counter struct {
+	col  int
+	name string
+	desc string
+}
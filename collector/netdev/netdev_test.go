@@ -0,0 +1,140 @@
+package netdev
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"stator/collector/procfs"
+	"stator/entity"
+)
+
+func TestNetDev(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "NetDev Suite")
+}
+
+var _ = Describe("NetDev", func() {
+	var (
+		cfg   *Config
+		nd    *NetDev
+		stats entity.PointsAt
+		err   error
+	)
+
+	BeforeEach(func() {
+		cfg = &Config{
+			Root:    "testdata/proc",
+			Exclude: []string{"lo"},
+		}
+
+		nd = cfg.New()
+	})
+
+	Describe("creating a collector", func() {
+		It("creates one with root and patterns", func() {
+			Expect(nd).To(Equal(&NetDev{
+				Root:   "testdata/proc",
+				Filter: procfs.Filter{Exclude: []string{"lo"}},
+			}))
+		})
+	})
+
+	Describe("collecting stats", func() {
+
+		JustBeforeEach(func() {
+			stats, err = nd.Collect(time.Time{})
+		})
+
+		When("all goes well", func() {
+			It("collects counters for all but excluded interfaces", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stats.Name).To(Equal("netdev"))
+
+				// 3 interfaces x 8 counters
+				Expect(stats.Points).To(HaveLen(24))
+
+				Expect(stats.Points[0]).To(Equal(entity.Point{
+					Name:   "rx_bytes",
+					Desc:   "Bytes received",
+					Unit:   "total",
+					Type:   "counter",
+					Labels: entity.Labels{{Key: "device", Val: "eth0"}},
+					Value:  entity.Uint{Data: 1894730211},
+				}))
+				Expect(stats.Points[3].Name).To(Equal("rx_drops"))
+				Expect(stats.Points[3].Value).To(Equal(entity.Uint{Data: 17}))
+				Expect(stats.Points[4].Name).To(Equal("tx_bytes"))
+				Expect(stats.Points[4].Value).To(Equal(entity.Uint{Data: 208839126}))
+				Expect(stats.Points[7].Name).To(Equal("tx_drops"))
+				Expect(stats.Points[7].Value).To(Equal(entity.Uint{Data: 2}))
+
+				Expect(stats.Points[8].Labels).To(Equal(entity.Labels{{Key: "device", Val: "vethab12cd"}}))
+				Expect(stats.Points[16].Labels).To(Equal(entity.Labels{{Key: "device", Val: "wlan0"}}))
+			})
+		})
+
+		When("including by pattern", func() {
+			BeforeEach(func() {
+				nd.Filter.Include = []string{"eth*", "wlan*"}
+				nd.Filter.Exclude = []string{"wlan*"}
+			})
+
+			It("collects only those included and not excluded", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stats.Points).To(HaveLen(8))
+				Expect(stats.Points[7].Labels).To(Equal(entity.Labels{{Key: "device", Val: "eth0"}}))
+			})
+		})
+
+		When("a pattern is malformed", func() {
+			BeforeEach(func() {
+				nd.Filter.Exclude = []string{"eth["}
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring(`failed to match pattern "eth["`)))
+			})
+		})
+
+		When("the file is missing", func() {
+			BeforeEach(func() {
+				nd.Root = "testdata"
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to read testdata/net/dev")))
+			})
+		})
+
+		When("a line is truncated", func() {
+			BeforeEach(func() {
+				root := GinkgoT().TempDir()
+				Expect(os.Mkdir(filepath.Join(root, "net"), 0o755)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(root, "net", "dev"), []byte("  eth0: 1 2 3\n"), 0o644)).To(Succeed())
+
+				nd.Root = root
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring("too few fields for eth0: 3")))
+			})
+		})
+
+		When("running against the real procfs", func() {
+			BeforeEach(func() {
+				nd.Root = "/proc"
+				nd.Filter.Exclude = nil
+			})
+
+			It("collects something", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stats.Points).ToNot(BeEmpty())
+			})
+		})
+	})
+})
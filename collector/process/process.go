@@ -0,0 +1,286 @@
+// Package process collects OS-level stats of the current process from Linux procfs.
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"stator/collector/procfs"
+	"stator/entity"
+)
+
+const (
+	name = "process"
+)
+
+// Config is Process configuration.
+type Config struct {
+	Enable bool   `json:"enable" desc:"collect process stats, linux only"`
+	Root   string `json:"procfs_root" desc:"procfs mount point" default:"/proc"`
+}
+
+// Process collects stats of the current process, along the lines of client_golang's
+// process collector.
+type Process struct {
+	Root string
+}
+
+// New creates a Process from Config.
+func (cfg *Config) New() *Process {
+
+	return &Process{
+		Root: cfg.Root,
+	}
+}
+
+// Collect collects stats.
+func (proc *Process) Collect(ts time.Time) (pa entity.PointsAt, err error) {
+
+	pa = entity.PointsAt{
+		Name:   name,
+		Stamp:  ts,
+		Points: []entity.Point{},
+	}
+
+	for _, collect := range []func() ([]entity.Point, error){proc.stat, proc.status, proc.fds} {
+		var pts []entity.Point
+		pts, err = collect()
+		if err != nil {
+			return
+		}
+		pa.Points = append(pa.Points, pts...)
+	}
+
+	return
+}
+
+// unexported
+
+func (proc *Process) read(file string) (data []byte, err error) {
+
+	path := filepath.Join(proc.Root, file)
+
+	data, err = os.ReadFile(path)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read %s", path)
+	}
+	return
+}
+
+func (proc *Process) stat() (pts []entity.Point, err error) {
+
+	// "42871 (sta tor) S 1 42871 ..." where comm may contain anything, parens included,
+	// so fields are counted from the last paren, state being the first
+
+	data, err := proc.read("self/stat")
+	if err != nil {
+		return
+	}
+
+	idx := bytes.LastIndexByte(data, ')')
+	if idx < 0 {
+		err = errors.Errorf("failed to parse self/stat, no comm: %q", data)
+		return
+	}
+
+	fields := strings.Fields(string(data[idx+1:]))
+	if len(fields) < 20 {
+		err = errors.Errorf("failed to parse self/stat, too few fields: %d", len(fields))
+		return
+	}
+
+	ticks := map[string]uint64{}
+	for name, idx := range map[string]int{"utime": 11, "stime": 12, "starttime": 19} {
+		ticks[name], err = strconv.ParseUint(fields[idx], 10, 64)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse %s", name)
+			return
+		}
+	}
+
+	boot, err := proc.bootTime()
+	if err != nil {
+		return
+	}
+
+	pts = []entity.Point{
+		{
+			Name:  "cpu_seconds",
+			Desc:  "User and system cpu time spent",
+			Unit:  "total",
+			Type:  "counter",
+			Value: entity.Float{Data: float64(ticks["utime"]+ticks["stime"]) / procfs.UserHz},
+		},
+		{
+			Name:  "start_time",
+			Desc:  "Start time of the process since the unix epoch",
+			Unit:  "seconds",
+			Type:  "gauge",
+			Value: entity.Float{Data: float64(boot) + float64(ticks["starttime"])/procfs.UserHz},
+		},
+	}
+
+	return
+}
+
+func (proc *Process) bootTime() (btime uint64, err error) {
+
+	// "btime 1760870000"
+
+	data, err := proc.read("stat")
+	if err != nil {
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		val, ok := strings.CutPrefix(scanner.Text(), "btime ")
+		if !ok {
+			continue
+		}
+
+		btime, err = strconv.ParseUint(strings.TrimSpace(val), 10, 64)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse btime")
+		}
+		return
+	}
+
+	err = errors.Errorf("failed to find btime in stat")
+	return
+}
+
+func (proc *Process) status() (pts []entity.Point, err error) {
+
+	// "VmRSS:	   14872 kB"
+
+	data, err := proc.read("self/status")
+	if err != nil {
+		return
+	}
+
+	found := map[string]uint64{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || (key != "VmRSS" && key != "VmSize" && key != "Threads") {
+			continue
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var val uint64
+		val, err = strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse status %s", key)
+			return
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			val *= 1024
+		}
+
+		found[key] = val
+	}
+
+	pts = []entity.Point{
+		{
+			Name:  "resident_memory",
+			Desc:  "Resident memory size",
+			Unit:  "bytes",
+			Type:  "gauge",
+			Value: entity.Uint{Data: found["VmRSS"]},
+		},
+		{
+			Name:  "virtual_memory",
+			Desc:  "Virtual memory size",
+			Unit:  "bytes",
+			Type:  "gauge",
+			Value: entity.Uint{Data: found["VmSize"]},
+		},
+		{
+			Name:  "threads",
+			Desc:  "Number of OS threads",
+			Type:  "gauge",
+			Value: entity.Uint{Data: found["Threads"]},
+		},
+	}
+
+	return
+}
+
+func (proc *Process) fds() (pts []entity.Point, err error) {
+
+	path := filepath.Join(proc.Root, "self", "fd")
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read %s", path)
+		return
+	}
+
+	pts = []entity.Point{
+		{
+			Name:  "open_fds",
+			Desc:  "Number of open file descriptors",
+			Type:  "gauge",
+			Value: entity.Uint{Data: uint64(len(entries))},
+		},
+	}
+
+	max, err := proc.maxFds()
+	if err != nil || max == 0 {
+		return
+	}
+
+	pts = append(pts, entity.Point{
+		Name:  "max_fds",
+		Desc:  "Maximum number of open file descriptors",
+		Type:  "gauge",
+		Value: entity.Uint{Data: max},
+	})
+
+	return
+}
+
+func (proc *Process) maxFds() (max uint64, err error) {
+
+	// "Max open files            1024                 1048576              files"
+	// soft limit, zero when unlimited
+
+	data, err := proc.read("self/limits")
+	if err != nil {
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		rest, ok := strings.CutPrefix(scanner.Text(), "Max open files")
+		if !ok {
+			continue
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) == 0 || fields[0] == "unlimited" {
+			return
+		}
+
+		max, err = strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse max open files")
+		}
+		return
+	}
+
+	return
+}
@@ -0,0 +1,175 @@
+package process
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"stator/entity"
+)
+
+func TestProcess(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Process Suite")
+}
+
+var _ = Describe("Process", func() {
+	var (
+		cfg   *Config
+		proc  *Process
+		stats entity.PointsAt
+		err   error
+	)
+
+	BeforeEach(func() {
+		cfg = &Config{
+			Root: "testdata/proc",
+		}
+
+		proc = cfg.New()
+	})
+
+	Describe("creating a collector", func() {
+		It("creates one with root", func() {
+			Expect(proc).To(Equal(&Process{
+				Root: "testdata/proc",
+			}))
+		})
+	})
+
+	Describe("collecting stats", func() {
+
+		JustBeforeEach(func() {
+			stats, err = proc.Collect(time.Time{})
+		})
+
+		When("all goes well", func() {
+			It("collects cpu, memory, threads, fds and start time", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stats.Name).To(Equal("process"))
+				Expect(stats.Points).To(HaveLen(7))
+
+				Expect(stats.Points[0]).To(Equal(entity.Point{
+					Name:  "cpu_seconds",
+					Desc:  "User and system cpu time spent",
+					Unit:  "total",
+					Type:  "counter",
+					Value: entity.Float{Data: 3.38},
+				}))
+				Expect(stats.Points[1].Name).To(Equal("start_time"))
+				Expect(stats.Points[1].Value).To(Equal(entity.Float{Data: 1760871234.56}))
+
+				Expect(stats.Points[2]).To(Equal(entity.Point{
+					Name:  "resident_memory",
+					Desc:  "Resident memory size",
+					Unit:  "bytes",
+					Type:  "gauge",
+					Value: entity.Uint{Data: 14872 * 1024},
+				}))
+				Expect(stats.Points[3].Value).To(Equal(entity.Uint{Data: 1237364 * 1024}))
+				Expect(stats.Points[4].Name).To(Equal("threads"))
+				Expect(stats.Points[4].Value).To(Equal(entity.Uint{Data: 9}))
+
+				Expect(stats.Points[5].Name).To(Equal("open_fds"))
+				Expect(stats.Points[5].Value).To(Equal(entity.Uint{Data: 5}))
+				Expect(stats.Points[6].Name).To(Equal("max_fds"))
+				Expect(stats.Points[6].Value).To(Equal(entity.Uint{Data: 1024}))
+			})
+		})
+
+		When("running against the real procfs", func() {
+			BeforeEach(func() {
+				proc.Root = "/proc"
+			})
+
+			It("collects something plausible", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stats.Points[1].Value.(entity.Float).Data).To(BeNumerically("~", float64(time.Now().Unix()), 3600))
+				Expect(stats.Points[2].Value.(entity.Uint).Data).To(BeNumerically(">", 0))
+			})
+		})
+
+		When("open files are unlimited", func() {
+			BeforeEach(func() {
+				proc.Root = copyFixtures(map[string]string{
+					"self/limits": "Limit  Soft Limit  Hard Limit  Units\nMax open files  unlimited  unlimited  files\n",
+				})
+			})
+
+			It("skips max fds", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stats.Points).To(HaveLen(6))
+			})
+		})
+
+		When("stat is truncated", func() {
+			BeforeEach(func() {
+				proc.Root = copyFixtures(map[string]string{
+					"self/stat": "42871 (stator) S 1 42871\n",
+				})
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring("too few fields: 3")))
+			})
+		})
+
+		When("btime is missing", func() {
+			BeforeEach(func() {
+				proc.Root = copyFixtures(map[string]string{
+					"stat": "cpu  4705 356 584 3699 23 23 0 0 0 0\n",
+				})
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError("failed to find btime in stat"))
+			})
+		})
+
+		When("a file is missing", func() {
+			BeforeEach(func() {
+				proc.Root = "testdata"
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to read testdata/self/stat")))
+			})
+		})
+	})
+})
+
+// copyFixtures copies testdata/proc to a temp dir, overwriting files with those given.
+func copyFixtures(files map[string]string) (root string) {
+
+	root = GinkgoT().TempDir()
+
+	err := filepath.WalkDir("testdata/proc", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		dest := filepath.Join(root, strings.TrimPrefix(path, "testdata/proc"))
+		if entry.IsDir() {
+			return os.MkdirAll(dest, 0o755)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dest, data, 0o644)
+	})
+	Expect(err).ToNot(HaveOccurred())
+
+	for file, data := range files {
+		Expect(os.WriteFile(filepath.Join(root, file), []byte(data), 0o644)).To(Succeed())
+	}
+
+	return
+}
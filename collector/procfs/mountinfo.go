@@ -0,0 +1,169 @@
+package procfs
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Mount is a line from mountinfo.
+type Mount struct {
+	Major      int
+	Minor      int
+	MountPoint string
+	FsType     string
+	Source     string
+	Options    []string
+}
+
+// Mounts is a mount table.
+type Mounts []Mount
+
+// ReadMounts reads the mount table from self/mountinfo under root.
+func ReadMounts(root string) (mounts Mounts, err error) {
+
+	// "26 22 253:0 / /var/lib/data ro,noatime shared:30 - xfs /dev/mapper/vg0-data rw,attr2"
+	// optional fields, "shared:30" here, run up to the "-" separator
+
+	file := filepath.Join(root, "self", "mountinfo")
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read %s", file)
+		return
+	}
+
+	mounts = Mounts{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 0 || sep+2 >= len(fields) {
+			err = errors.Errorf("failed to parse %s, malformed line: %q", file, scanner.Text())
+			return
+		}
+
+		var mount Mount
+		mount, err = parseDev(fields[2])
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse %s", file)
+			return
+		}
+
+		mount.MountPoint = unescape(fields[4])
+		mount.Options = strings.Split(fields[5], ",")
+		mount.FsType = fields[sep+1]
+		mount.Source = unescape(fields[sep+2])
+
+		mounts = append(mounts, mount)
+	}
+
+	return
+}
+
+// Find returns the mount on which path resides, the one with the longest mount point
+// containing it, later mounts shadowing earlier.
+func (mounts Mounts) Find(path string) (mount Mount, ok bool) {
+
+	path = filepath.Clean(path)
+	longest := -1
+
+	for _, mnt := range mounts {
+		if !within(path, mnt.MountPoint) || len(mnt.MountPoint) < longest {
+			continue
+		}
+
+		mount = mnt
+		longest = len(mnt.MountPoint)
+		ok = true
+	}
+
+	return
+}
+
+// Device returns the device's "major:minor" identifier.
+func (mount Mount) Device() string {
+
+	return strconv.Itoa(mount.Major) + ":" + strconv.Itoa(mount.Minor)
+}
+
+// ReadOnly reports whether the mount is read-only.
+func (mount Mount) ReadOnly() bool {
+
+	for _, opt := range mount.Options {
+		if opt == "ro" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unexported
+
+func parseDev(dev string) (mount Mount, err error) {
+
+	major, minor, ok := strings.Cut(dev, ":")
+	if !ok {
+		err = errors.Errorf("malformed device: %q", dev)
+		return
+	}
+
+	mount.Major, err = strconv.Atoi(major)
+	if err != nil {
+		err = errors.Wrapf(err, "malformed device major: %q", dev)
+		return
+	}
+
+	mount.Minor, err = strconv.Atoi(minor)
+	if err != nil {
+		err = errors.Wrapf(err, "malformed device minor: %q", dev)
+	}
+	return
+}
+
+func within(path, mountPoint string) bool {
+
+	if mountPoint == "/" {
+		return strings.HasPrefix(path, "/")
+	}
+
+	return path == mountPoint || strings.HasPrefix(path, mountPoint+"/")
+}
+
+func unescape(field string) string {
+
+	// mountinfo octal escapes space, tab, newline and backslash, as in "\040"
+
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+4 <= len(field) {
+			code, err := strconv.ParseUint(field[i+1:i+4], 8, 8)
+			if err == nil {
+				out.WriteByte(byte(code))
+				i += 3
+				continue
+			}
+		}
+		out.WriteByte(field[i])
+	}
+
+	return out.String()
+}
@@ -0,0 +1,116 @@
+package procfs
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mounts", func() {
+	var (
+		root   string
+		mounts Mounts
+		err    error
+	)
+
+	BeforeEach(func() {
+		root = "testdata/proc"
+	})
+
+	JustBeforeEach(func() {
+		mounts, err = ReadMounts(root)
+	})
+
+	Describe("reading mountinfo", func() {
+
+		When("all goes well", func() {
+			It("parses each mount", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(mounts).To(HaveLen(6))
+
+				Expect(mounts[4]).To(Equal(Mount{
+					Major:      253,
+					Minor:      0,
+					MountPoint: "/var/lib/data",
+					FsType:     "xfs",
+					Source:     "/dev/mapper/vg0-data",
+					Options:    []string{"ro", "noatime"},
+				}))
+				Expect(mounts[4].Device()).To(Equal("253:0"))
+				Expect(mounts[4].ReadOnly()).To(BeTrue())
+				Expect(mounts[0].ReadOnly()).To(BeFalse())
+
+				Expect(mounts[5].MountPoint).To(Equal("/mnt/with space"))
+			})
+		})
+
+		When("a line is malformed", func() {
+			BeforeEach(func() {
+				root = GinkgoT().TempDir()
+				Expect(os.Mkdir(filepath.Join(root, "self"), 0o755)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(root, "self", "mountinfo"), []byte("22 1 259:2 / / rw\n"), 0o644)).To(Succeed())
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring("malformed line")))
+			})
+		})
+
+		When("the file is missing", func() {
+			BeforeEach(func() {
+				root = "testdata"
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to read testdata/self/mountinfo")))
+			})
+		})
+	})
+
+	Describe("finding the mount for a path", func() {
+		var (
+			path  string
+			mount Mount
+			ok    bool
+		)
+
+		JustBeforeEach(func() {
+			mount, ok = mounts.Find(path)
+		})
+
+		When("path is under a nested mount", func() {
+			BeforeEach(func() {
+				path = "/var/lib/data/db/"
+			})
+
+			It("finds the nested mount", func() {
+				Expect(ok).To(BeTrue())
+				Expect(mount.MountPoint).To(Equal("/var/lib/data"))
+			})
+		})
+
+		When("path only shares a prefix with a mount", func() {
+			BeforeEach(func() {
+				path = "/var/lib/database"
+			})
+
+			It("finds the root mount", func() {
+				Expect(ok).To(BeTrue())
+				Expect(mount.MountPoint).To(Equal("/"))
+				Expect(mount.Device()).To(Equal("259:2"))
+			})
+		})
+
+		When("path is relative", func() {
+			BeforeEach(func() {
+				path = "var"
+			})
+
+			It("finds nothing", func() {
+				Expect(ok).To(BeFalse())
+			})
+		})
+	})
+})
@@ -0,0 +1,76 @@
+// Package procfs provides helpers shared among the collectors reading Linux procfs.
+package procfs
+
+import (
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// UserHz is the tick rate of times in procfs, fixed at 100 on all architectures but alpha.
+const UserHz = 100
+
+// Filter selects names by glob pattern, as in path.Match.
+//
+// With Prefix set, names are slash separated paths and a pattern matching any leading
+// part of one matches it as well, such that "/run" matches "/run/user/1000".
+type Filter struct {
+	Include []string
+	Exclude []string
+	Prefix  bool
+}
+
+// Match reports whether name is included, or there are no includes, and not excluded.
+func (flt Filter) Match(name string) (ok bool, err error) {
+
+	ok = len(flt.Include) == 0
+	if !ok {
+		ok, err = flt.match(flt.Include, name)
+		if err != nil || !ok {
+			return
+		}
+	}
+
+	excluded, err := flt.match(flt.Exclude, name)
+	if err != nil {
+		return
+	}
+
+	ok = !excluded
+	return
+}
+
+// unexported
+
+func (flt Filter) match(patterns []string, name string) (ok bool, err error) {
+
+	ok, err = match(patterns, name)
+	if err != nil || ok || !flt.Prefix {
+		return
+	}
+
+	for dir := path.Dir(name); dir != name; name, dir = dir, path.Dir(dir) {
+		ok, err = match(patterns, dir)
+		if err != nil || ok {
+			return
+		}
+	}
+
+	return
+}
+
+func match(patterns []string, name string) (ok bool, err error) {
+
+	for _, pattern := range patterns {
+		ok, err = path.Match(pattern, name)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to match pattern %q", pattern)
+			return
+		}
+		if ok {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,122 @@
+package procfs
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestProcFs(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ProcFs Suite")
+}
+
+var _ = Describe("Filter", func() {
+	var (
+		flt  Filter
+		name string
+		ok   bool
+		err  error
+	)
+
+	BeforeEach(func() {
+		flt = Filter{
+			Include: []string{"sd*", "nvme*"},
+			Exclude: []string{"sdz"},
+		}
+		name = "sda"
+	})
+
+	JustBeforeEach(func() {
+		ok, err = flt.Match(name)
+	})
+
+	When("included", func() {
+		It("matches", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+	})
+
+	When("not included", func() {
+		BeforeEach(func() {
+			name = "loop0"
+		})
+
+		It("does not match", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	When("included and excluded", func() {
+		BeforeEach(func() {
+			name = "sdz"
+		})
+
+		It("does not match", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	When("there are no includes", func() {
+		BeforeEach(func() {
+			flt.Include = nil
+			name = "loop0"
+		})
+
+		It("matches all but excluded", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+	})
+
+	When("matching on prefix", func() {
+		BeforeEach(func() {
+			flt = Filter{
+				Exclude: []string{"/run", "/var/lib/*"},
+				Prefix:  true,
+			}
+			name = "/run/user/1000"
+		})
+
+		It("does not match beneath an excluded path", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		When("beneath an excluded pattern", func() {
+			BeforeEach(func() {
+				name = "/var/lib/docker/overlay2"
+			})
+
+			It("does not match", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ok).To(BeFalse())
+			})
+		})
+
+		When("merely sharing a leading string", func() {
+			BeforeEach(func() {
+				name = "/runner"
+			})
+
+			It("matches", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ok).To(BeTrue())
+			})
+		})
+	})
+
+	When("a pattern is malformed", func() {
+		BeforeEach(func() {
+			flt.Exclude = []string{"sd["}
+		})
+
+		It("errors", func() {
+			Expect(err).To(MatchError(ContainSubstring(`failed to match pattern "sd["`)))
+		})
+	})
+})
@@ -0,0 +1,283 @@
+// Package scrape collects stats from other Prometheus endpoints.
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"stator/entity"
+	"stator/formatter/prometheus"
+)
+
+const (
+	name = "scrape"
+	// Header marks scrape requests, so that a stator receiving one does not scrape in turn.
+	Header = "X-Stator-Scrape"
+)
+
+//go:generate moq -out mock_test.go . Logger
+
+// Logger specifies a logger.
+type Logger interface {
+	Error(ctx context.Context, msg string, err error, kv ...any)
+}
+
+// Config is Scrape configuration.
+type Config struct {
+	Targets []TargetConfig `json:"targets" desc:"urls of metrics endpoints to scrape, each optionally suffixed with its own timeout as in url|2s"`
+	Job     string         `json:"job" desc:"job label for scraped stats" default:"federate"`
+	Timeout time.Duration  `json:"timeout" desc:"scrape timeout for targets without their own" default:"5s"`
+}
+
+// TargetConfig is configuration for a target, with zero timeout for Config's.
+type TargetConfig struct {
+	Url     string        `json:"url"`
+	Timeout time.Duration `json:"timeout"`
+}
+
+// Decode decodes a target from "url[|timeout]", implementing envconfig.Decoder.
+//
+// For example: "http://localhost:9100/metrics|2s".
+func (tc *TargetConfig) Decode(value string) (err error) {
+
+	uri, tmo, ok := strings.Cut(value, "|")
+	if uri == "" {
+		err = errors.Errorf("expected url[|timeout], got: %s", value)
+		return
+	}
+
+	tc.Url = uri
+	tc.Timeout = 0
+
+	if ok {
+		tc.Timeout, err = time.ParseDuration(tmo)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse scrape timeout")
+			return
+		}
+		if tc.Timeout <= 0 {
+			err = errors.Errorf("scrape timeout must be positive, got: %s", tmo)
+		}
+	}
+
+	return
+}
+
+// Target is an endpoint to be scraped.
+type Target struct {
+	Url     string
+	Timeout time.Duration
+}
+
+// Scrape collects stats from a list of targets.
+//
+// Scraped points are labeled with job and instance, with any existing
+// labels of the same name moved aside to exported_job and exported_instance.
+// Scraped timestamps are dropped in favor of collection time.
+// A target that cannot be scraped does not fail collection, rather its "up" point reads zero.
+//
+// Targets may be replaced while collecting via SetTargets, as when following discovery.
+// Failures to scrape are logged with their cause.
+type Scrape struct {
+	Client  *http.Client
+	Logger  Logger
+	Job     string
+	Targets []Target
+
+	mu sync.Mutex
+}
+
+// New creates a Scrape from Config.
+func (cfg *Config) New(lgr Logger) *Scrape {
+
+	targets := make([]Target, len(cfg.Targets))
+	for i, tc := range cfg.Targets {
+		targets[i] = Target(tc)
+		if targets[i].Timeout <= 0 {
+			targets[i].Timeout = cfg.Timeout
+		}
+	}
+
+	return &Scrape{
+		Client:  &http.Client{},
+		Logger:  lgr,
+		Job:     cfg.Job,
+		Targets: targets,
+	}
+}
+
+// SetTargets replaces the targets to be scraped.
+func (scr *Scrape) SetTargets(targets []Target) {
+
+	scr.mu.Lock()
+	defer scr.mu.Unlock()
+
+	scr.Targets = targets
+}
+
+// Collect collects stats.
+func (scr *Scrape) Collect(ts time.Time) (pa entity.PointsAt, err error) {
+
+	// scraping concurrently so that slow targets cost only their own timeout
+
+	scr.mu.Lock()
+	targets := scr.Targets
+	scr.mu.Unlock()
+
+	scraped := make([][]entity.Point, len(targets))
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+
+		wg.Add(1)
+		go func(i int, target Target) {
+			defer wg.Done()
+			scraped[i] = scr.scrape(target)
+		}(i, target)
+	}
+	wg.Wait()
+
+	pa = entity.PointsAt{
+		Name:   name,
+		Stamp:  ts,
+		Points: []entity.Point{},
+	}
+
+	for _, points := range scraped {
+		pa.Points = append(pa.Points, points...)
+	}
+
+	return
+}
+
+// unexported
+
+func (scr *Scrape) scrape(target Target) (points []entity.Point) {
+
+	labels := entity.Labels{
+		{Key: "job", Val: scr.Job},
+		{Key: "instance", Val: instance(target.Url)},
+	}
+
+	start := time.Now()
+	stats, err := scr.fetch(target)
+	elapsed := time.Since(start)
+
+	var up uint64
+	if err == nil {
+		up = 1
+	} else {
+		scr.Logger.Error(context.Background(), "failed to scrape", err, "target", target.Url)
+	}
+
+	points = []entity.Point{
+		{
+			Name:   "up",
+			Desc:   "Whether the target was scraped successfully",
+			Type:   "gauge",
+			Labels: labels,
+			Value:  entity.Uint{Data: up},
+		},
+		{
+			Name:   "scrape_duration",
+			Desc:   "Time taken to scrape the target",
+			Unit:   "seconds",
+			Type:   "gauge",
+			Labels: labels,
+			Value:  entity.Float{Data: elapsed.Seconds()},
+		},
+	}
+
+	for _, fam := range stats {
+		for _, pt := range fam.Points {
+
+			name := fam.Name
+			if pt.Name != "" {
+				name = fmt.Sprintf("%s_%s", name, pt.Name)
+			}
+
+			pt.Name = name
+			pt.Labels = relabel(append(fam.Labels, pt.Labels...), labels)
+			points = append(points, pt)
+		}
+	}
+
+	return
+}
+
+func (scr *Scrape) fetch(target Target) (stats entity.Stats, err error) {
+
+	if target.Timeout <= 0 {
+		err = errors.Errorf("no valid timeout for %s", target.Url)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), target.Timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target.Url, nil)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to create request for %s", target.Url)
+		return
+	}
+	request.Header.Set("Accept", "text/plain;version=0.0.4")
+	request.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", fmt.Sprintf("%g", target.Timeout.Seconds()))
+	request.Header.Set(Header, "true")
+
+	response, err := scr.Client.Do(request)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to scrape %s", target.Url)
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		err = errors.Errorf("unexpected status %d from %s", response.StatusCode, target.Url)
+		return
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read response from %s", target.Url)
+		return
+	}
+
+	stats, err = prometheus.Prometheus{}.Parse(body)
+	return
+}
+
+func relabel(scraped, target entity.Labels) (labels entity.Labels) {
+
+	labels = entity.Labels{}
+	labels = append(labels, target...)
+
+	for _, lbl := range scraped {
+		for _, tl := range target {
+			if lbl.Key == tl.Key {
+				lbl.Key = "exported_" + lbl.Key
+				break
+			}
+		}
+		labels = append(labels, lbl)
+	}
+
+	return
+}
+
+func instance(uri string) string {
+
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Host == "" {
+		return uri
+	}
+
+	return parsed.Host
+}
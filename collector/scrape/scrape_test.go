@@ -0,0 +1,261 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"stator/entity"
+)
+
+func TestScrape(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Scrape Suite")
+}
+
+var _ = Describe("Scrape", func() {
+	var (
+		cfg *Config
+		lgr *LoggerMock
+		scr *Scrape
+	)
+
+	BeforeEach(func() {
+		cfg = &Config{
+			Targets: []TargetConfig{
+				{Url: "http://localhost:9100/metrics"},
+				{Url: "http://localhost:9101/metrics", Timeout: 2 * time.Second},
+			},
+			Job:     "federate",
+			Timeout: 5 * time.Second,
+		}
+
+		lgr = &LoggerMock{
+			ErrorFunc: func(ctx context.Context, msg string, err error, kv ...any) {},
+		}
+
+		scr = cfg.New(lgr)
+	})
+
+	Describe("creating a collector", func() {
+		It("creates one with a target per url, each with its own timeout if given", func() {
+			Expect(scr).To(Equal(&Scrape{
+				Client: &http.Client{},
+				Logger: lgr,
+				Job:    "federate",
+				Targets: []Target{
+					{Url: "http://localhost:9100/metrics", Timeout: 5 * time.Second},
+					{Url: "http://localhost:9101/metrics", Timeout: 2 * time.Second},
+				},
+			}))
+		})
+	})
+
+	Describe("decoding a target config", func() {
+		var (
+			spec string
+			tc   TargetConfig
+			err  error
+		)
+
+		JustBeforeEach(func() {
+			tc = TargetConfig{}
+			err = tc.Decode(spec)
+		})
+
+		When("timeout is given", func() {
+			BeforeEach(func() {
+				spec = "http://localhost:9101/metrics|2s"
+			})
+
+			It("decodes url and timeout", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tc).To(Equal(TargetConfig{Url: "http://localhost:9101/metrics", Timeout: 2 * time.Second}))
+			})
+		})
+
+		When("timeout is omitted", func() {
+			BeforeEach(func() {
+				spec = "http://localhost:9100/metrics"
+			})
+
+			It("leaves it zero", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tc).To(Equal(TargetConfig{Url: "http://localhost:9100/metrics"}))
+			})
+		})
+
+		When("timeout is garbage", func() {
+			BeforeEach(func() {
+				spec = "http://localhost:9102/metrics|bargle"
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to parse scrape timeout")))
+			})
+		})
+
+		When("timeout is not positive", func() {
+			BeforeEach(func() {
+				spec = "http://localhost:9102/metrics|0s"
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError("scrape timeout must be positive, got: 0s"))
+			})
+		})
+
+		When("url is missing", func() {
+			BeforeEach(func() {
+				spec = "|2s"
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError("expected url[|timeout], got: |2s"))
+			})
+		})
+	})
+
+	Describe("collecting stats", func() {
+		var (
+			good   *httptest.Server
+			bad    *httptest.Server
+			slow   *httptest.Server
+			stamp  time.Time
+			marked string
+			pa     entity.PointsAt
+			err    error
+		)
+
+		BeforeEach(func() {
+			good = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				marked = request.Header.Get(Header)
+				fmt.Fprint(writer, exposition)
+			}))
+			bad = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				writer.WriteHeader(http.StatusInternalServerError)
+			}))
+			slow = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				time.Sleep(200 * time.Millisecond)
+				fmt.Fprint(writer, exposition)
+			}))
+
+			stamp = time.UnixMilli(1700000000000)
+		})
+
+		AfterEach(func() {
+			good.Close()
+			bad.Close()
+			slow.Close()
+		})
+
+		JustBeforeEach(func() {
+			pa, err = scr.Collect(stamp)
+		})
+
+		When("all goes well", func() {
+			BeforeEach(func() {
+				scr.SetTargets([]Target{{Url: good.URL + "/metrics", Timeout: time.Second}})
+			})
+
+			It("collects labeled points stamped with collection time", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(pa.Name).To(Equal("scrape"))
+				Expect(pa.Stamp).To(Equal(stamp))
+
+				inst := strings.TrimPrefix(good.URL, "http://")
+				Expect(pa.Points).To(HaveLen(5))
+
+				Expect(pa.Points[0].Name).To(Equal("up"))
+				Expect(pa.Points[0].Value).To(Equal(entity.Uint{Data: 1}))
+				Expect(pa.Points[0].Labels).To(Equal(entity.Labels{
+					{Key: "job", Val: "federate"},
+					{Key: "instance", Val: inst},
+				}))
+
+				Expect(pa.Points[1].Name).To(Equal("scrape_duration"))
+
+				Expect(pa.Points[2]).To(Equal(entity.Point{
+					Name: "node_load1",
+					Desc: "1m load average.",
+					Type: "gauge",
+					Labels: entity.Labels{
+						{Key: "job", Val: "federate"},
+						{Key: "instance", Val: inst},
+					},
+					Value: entity.Float{Data: 0.21},
+				}))
+
+				Expect(pa.Points[3]).To(Equal(entity.Point{
+					Name: "requests_total",
+					Desc: "Requests served.",
+					Type: "counter",
+					Labels: entity.Labels{
+						{Key: "job", Val: "federate"},
+						{Key: "instance", Val: inst},
+						{Key: "exported_job", Val: "sidecar"},
+						{Key: "code", Val: "200"},
+					},
+					Value: entity.Uint{Data: 1027},
+				}))
+
+				Expect(pa.Points[4].Name).To(Equal("requests_total"))
+				Expect(marked).To(Equal("true"))
+			})
+		})
+
+		When("targets fail or are too slow", func() {
+			BeforeEach(func() {
+				scr.Targets = []Target{
+					{Url: bad.URL, Timeout: time.Second},
+					{Url: slow.URL, Timeout: 50 * time.Millisecond},
+					{Url: good.URL, Timeout: time.Second},
+					{Url: good.URL},
+				}
+			})
+
+			It("reports them down and carries on with the rest", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(pa.Points).To(HaveLen(2 + 2 + 5 + 2))
+
+				Expect(pa.Points[0].Name).To(Equal("up"))
+				Expect(pa.Points[0].Value).To(Equal(entity.Uint{Data: 0}))
+
+				Expect(pa.Points[2].Name).To(Equal("up"))
+				Expect(pa.Points[2].Value).To(Equal(entity.Uint{Data: 0}))
+
+				Expect(pa.Points[4].Name).To(Equal("up"))
+				Expect(pa.Points[4].Value).To(Equal(entity.Uint{Data: 1}))
+
+				Expect(pa.Points[9].Name).To(Equal("up"))
+				Expect(pa.Points[9].Value).To(Equal(entity.Uint{Data: 0}))
+
+				ec := lgr.ErrorCalls()
+				Expect(ec).To(HaveLen(3))
+				for _, call := range ec {
+					Expect(call.Msg).To(Equal("failed to scrape"))
+				}
+				Expect(ec).To(ContainElement(HaveField("Err", MatchError(fmt.Sprintf("unexpected status 500 from %s", bad.URL)))))
+				Expect(ec).To(ContainElement(HaveField("Kv", Equal([]any{"target", slow.URL}))))
+			})
+		})
+	})
+})
+
+var exposition = `
+# HELP node_load1 1m load average.
+# TYPE node_load1 gauge
+node_load1 0.21 1395066363000
+
+# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{job="sidecar",code="200"} 1027
+requests_total{job="sidecar",code="500"} 3
+`
@@ -0,0 +1,277 @@
+package prometheus
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"stator/entity"
+)
+
+// Parse parses Prometheus text exposition into stats.
+//
+// Consecutive samples from the same family with the same timestamp are gathered
+// into a PointsAt named for the family, with each point carrying the remainder of
+// the sample name (blank, or "bucket", "sum", "count" for histograms and summaries).
+// Samples without a timestamp are left with a zero Stamp for the caller to fill.
+//
+// In the spirit of: https://prometheus.io/docs/instrumenting/exposition_formats/#text-format-details
+func (om Prometheus) Parse(data []byte) (stats entity.Stats, err error) {
+
+	prs := &parser{
+		help:  map[string]string{},
+		types: map[string]string{},
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for num := 1; scanner.Scan(); num++ {
+
+		err = prs.line(scanner.Text())
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse line %d", num)
+			return
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		err = errors.Wrapf(err, "failed to scan exposition")
+		return
+	}
+
+	stats = prs.stats
+	return
+}
+
+// unexported
+
+type parser struct {
+	help  map[string]string
+	types map[string]string
+	stats entity.Stats
+}
+
+type sample struct {
+	name   string
+	labels entity.Labels
+	value  entity.Value
+	stamp  time.Time
+}
+
+func (prs *parser) line(line string) (err error) {
+
+	line = strings.TrimSpace(line)
+
+	switch {
+	case line == "":
+		return
+	case strings.HasPrefix(line, "#"):
+		prs.comment(line)
+		return
+	}
+
+	smp, err := parseSample(line)
+	if err != nil {
+		return
+	}
+
+	prs.add(smp)
+	return
+}
+
+func (prs *parser) comment(line string) {
+
+	fields := strings.SplitN(strings.TrimSpace(line[1:]), " ", 3)
+	if len(fields) < 3 {
+		return
+	}
+
+	switch fields[0] {
+	case "HELP":
+		prs.help[fields[1]] = helpUnescaper.Replace(fields[2])
+	case "TYPE":
+		prs.types[fields[1]] = strings.TrimSpace(fields[2])
+	}
+}
+
+func (prs *parser) add(smp sample) {
+
+	fam, rest := prs.family(smp.name)
+
+	typ, ok := prs.types[fam]
+	if !ok {
+		typ = "untyped"
+	}
+
+	pt := entity.Point{
+		Name:   rest,
+		Desc:   prs.help[fam],
+		Type:   typ,
+		Labels: smp.labels,
+		Value:  smp.value,
+	}
+
+	last := len(prs.stats) - 1
+	if last >= 0 && prs.stats[last].Name == fam && prs.stats[last].Stamp.Equal(smp.stamp) {
+		prs.stats[last].Points = append(prs.stats[last].Points, pt)
+		return
+	}
+
+	prs.stats = append(prs.stats, entity.PointsAt{
+		Name:   fam,
+		Stamp:  smp.stamp,
+		Points: []entity.Point{pt},
+	})
+}
+
+func (prs *parser) family(name string) (fam, rest string) {
+
+	_, ok := prs.types[name]
+	if ok {
+		return name, ""
+	}
+
+	for typ, sfxs := range suffixes {
+		for _, sfx := range sfxs {
+
+			trimmed, ok := strings.CutSuffix(name, "_"+sfx)
+			if ok && prs.types[trimmed] == typ {
+				return trimmed, sfx
+			}
+		}
+	}
+
+	return name, ""
+}
+
+func parseSample(line string) (smp sample, err error) {
+
+	idx := strings.IndexAny(line, "{ \t")
+	if idx < 1 {
+		err = errors.Errorf("missing value for sample: %s", line)
+		return
+	}
+
+	smp.name = line[:idx]
+	rest := line[idx:]
+
+	if rest[0] == '{' {
+		smp.labels, rest, err = parseLabels(rest[1:])
+		if err != nil {
+			return
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) < 1 || len(fields) > 2 {
+		err = errors.Errorf("expected value and optional timestamp for: %s", smp.name)
+		return
+	}
+
+	smp.value, err = parseValue(fields[0])
+	if err != nil {
+		return
+	}
+
+	if len(fields) == 2 {
+		var ms int64
+		ms, err = strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse timestamp for: %s", smp.name)
+			return
+		}
+		smp.stamp = time.UnixMilli(ms)
+	}
+
+	return
+}
+
+func parseLabels(in string) (labels entity.Labels, rest string, err error) {
+
+	labels = entity.Labels{}
+
+	for {
+		in = strings.TrimLeft(in, " \t")
+		if in == "" {
+			err = errors.Errorf("unterminated label set")
+			return
+		}
+		if in[0] == '}' {
+			rest = in[1:]
+			return
+		}
+
+		eq := strings.IndexByte(in, '=')
+		if eq < 1 || len(in) < eq+2 || in[eq+1] != '"' {
+			err = errors.Errorf("malformed label near: %s", in)
+			return
+		}
+
+		key := strings.TrimSpace(in[:eq])
+
+		var val string
+		val, in, err = unquote(in[eq+2:])
+		if err != nil {
+			return
+		}
+
+		labels = append(labels, entity.Label{Key: key, Val: val})
+
+		in = strings.TrimLeft(in, " \t")
+		in = strings.TrimPrefix(in, ",")
+	}
+}
+
+func unquote(in string) (val, rest string, err error) {
+
+	builder := &strings.Builder{}
+
+	for i := 0; i < len(in); i++ {
+		switch in[i] {
+		case '"':
+			val = builder.String()
+			rest = in[i+1:]
+			return
+		case '\\':
+			i++
+			if i == len(in) {
+				break
+			}
+			switch in[i] {
+			case 'n':
+				builder.WriteByte('\n')
+			default:
+				builder.WriteByte(in[i])
+			}
+		default:
+			builder.WriteByte(in[i])
+		}
+	}
+
+	err = errors.Errorf("unterminated label value")
+	return
+}
+
+func parseValue(str string) (val entity.Value, err error) {
+
+	// whole numbers come back as Uint, anything else as Float
+
+	ui, err := strconv.ParseUint(str, 10, 64)
+	if err == nil {
+		val = entity.Uint{Data: ui}
+		return
+	}
+
+	fl, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to parse value")
+		return
+	}
+
+	val = entity.Float{Data: fl}
+	return
+}
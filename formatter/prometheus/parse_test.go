@@ -0,0 +1,231 @@
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"stator/entity"
+)
+
+var _ = Describe("Parse", func() {
+	var (
+		om    Prometheus
+		data  []byte
+		stats entity.Stats
+		err   error
+	)
+
+	JustBeforeEach(func() {
+		stats, err = om.Parse(data)
+	})
+
+	Describe("parsing exposition text", func() {
+
+		When("all goes well", func() {
+			BeforeEach(func() {
+				data = []byte(exposition)
+			})
+
+			It("gathers families with help, type, labels and stamps", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stats).To(Equal(entity.Stats{
+					{
+						Name:  "http_requests_total",
+						Stamp: time.UnixMilli(1395066363000),
+						Points: []entity.Point{
+							{
+								Desc:   "The total number of HTTP requests.",
+								Type:   "counter",
+								Labels: entity.Labels{{Key: "method", Val: "post"}, {Key: "code", Val: "200"}},
+								Value:  entity.Uint{Data: 1027},
+							},
+							{
+								Desc:   "The total number of HTTP requests.",
+								Type:   "counter",
+								Labels: entity.Labels{{Key: "method", Val: "post"}, {Key: "code", Val: "400"}},
+								Value:  entity.Uint{Data: 3},
+							},
+						},
+					},
+					{
+						Name: "msdos_file_access_time_seconds",
+						Points: []entity.Point{
+							{
+								Type: "untyped",
+								Labels: entity.Labels{
+									{Key: "path", Val: `C:\DIR\FILE.TXT`},
+									{Key: "error", Val: "Cannot find file:\n\"FILE.TXT\""},
+								},
+								Value: entity.Float{Data: 1.458255915e9},
+							},
+						},
+					},
+					{
+						Name: "http_request_duration_seconds",
+						Points: []entity.Point{
+							{
+								Name:   "bucket",
+								Desc:   "A histogram of the request duration.",
+								Type:   "histogram",
+								Labels: entity.Labels{{Key: "le", Val: "0.05"}},
+								Value:  entity.Uint{Data: 24054},
+							},
+							{
+								Name:   "bucket",
+								Desc:   "A histogram of the request duration.",
+								Type:   "histogram",
+								Labels: entity.Labels{{Key: "le", Val: "+Inf"}},
+								Value:  entity.Uint{Data: 144320},
+							},
+							{
+								Name:  "sum",
+								Desc:  "A histogram of the request duration.",
+								Type:  "histogram",
+								Value: entity.Uint{Data: 53423},
+							},
+							{
+								Name:  "count",
+								Desc:  "A histogram of the request duration.",
+								Type:  "histogram",
+								Value: entity.Uint{Data: 144320},
+							},
+						},
+					},
+				}))
+			})
+		})
+
+		When("a label value is unterminated", func() {
+			BeforeEach(func() {
+				data = []byte("\nbargle{path=\"/boot} 99\n")
+			})
+
+			It("errors with the line number", func() {
+				Expect(err).To(MatchError("failed to parse line 2: unterminated label value"))
+			})
+		})
+
+		When("a value is garbage", func() {
+			BeforeEach(func() {
+				data = []byte("bargle{} ninety-nine\n")
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to parse value")))
+			})
+		})
+	})
+
+	Describe("round-tripping formatted stats", func() {
+		var (
+			rnd *rand.Rand
+		)
+
+		BeforeEach(func() {
+			rnd = rand.New(rand.NewSource(42)) //nolint: gosec
+		})
+
+		It("formats parsed stats just as they were formatted originally", func() {
+			for i := 0; i < 200; i++ {
+
+				pa := randomPointsAt(rnd)
+				formatted := om.Format(pa)
+
+				parsed, err := om.Parse(formatted)
+				Expect(err).ToNot(HaveOccurred())
+
+				buf := bytes.Buffer{}
+				for _, pa := range parsed {
+					buf.Write(om.Format(pa))
+				}
+
+				Expect(buf.String()).To(Equal(string(formatted)))
+			}
+		})
+
+		It("round-trips a histogram", func() {
+			pa := entity.PointsAt{
+				Name:  "latency",
+				Stamp: time.UnixMilli(1700000000000),
+				Points: []entity.Point{
+					{Name: "bucket", Type: "histogram", Desc: "Latency.", Labels: entity.Labels{{Key: "le", Val: "1"}}, Value: entity.Uint{Data: 3}},
+					{Name: "bucket", Type: "histogram", Desc: "Latency.", Labels: entity.Labels{{Key: "le", Val: "+Inf"}}, Value: entity.Uint{Data: 5}},
+					{Name: "sum", Type: "histogram", Desc: "Latency.", Value: entity.Float{Data: 4.5}},
+					{Name: "count", Type: "histogram", Desc: "Latency.", Value: entity.Uint{Data: 5}},
+				},
+			}
+
+			formatted := om.Format(pa)
+			Expect(string(formatted)).To(HavePrefix("\n# HELP latency Latency.\n# TYPE latency histogram\n"))
+
+			parsed, err := om.Parse(formatted)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed).To(HaveLen(1))
+			Expect(om.Format(parsed[0])).To(Equal(formatted))
+		})
+	})
+})
+
+func randomPointsAt(rnd *rand.Rand) entity.PointsAt {
+
+	pick := func(strs ...string) string {
+		return strs[rnd.Intn(len(strs))]
+	}
+
+	pa := entity.PointsAt{
+		Name:  pick("common", "du", "gort"),
+		Stamp: time.UnixMilli(rnd.Int63n(2e12) - 1e12),
+		Labels: entity.Labels{
+			{Key: "cid", Val: pick("valero", `back\slash`, `"quoted"`, "new\nline", "")},
+		},
+	}
+
+	for i := 0; i < 1+rnd.Intn(5); i++ {
+
+		name := pick("particular", "size", "total")
+		unit := pick("", "bytes", "seconds")
+
+		typ := "gauge"
+		if name == "total" {
+			typ = "counter"
+		}
+
+		var val entity.Value = entity.Uint{Data: rnd.Uint64()}
+		if rnd.Intn(2) == 0 {
+			val = entity.Float{Data: rnd.NormFloat64() * 1e6}
+		}
+
+		pa.Points = append(pa.Points, entity.Point{
+			Name:   name,
+			Unit:   unit,
+			Desc:   fmt.Sprintf("Dummy %s point,\nwith a \\ for test.", name),
+			Type:   typ,
+			Labels: entity.Labels{{Key: "path", Val: pick("/", "/boot", `C:\DIR`)}},
+			Value:  val,
+		})
+	}
+
+	return pa
+}
+
+var exposition = `
+# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="post",code="400"}    3 1395066363000
+
+# Escaping in label values:
+msdos_file_access_time_seconds{path="C:\\DIR\\FILE.TXT",error="Cannot find file:\n\"FILE.TXT\""} 1.458255915e9
+
+# HELP http_request_duration_seconds A histogram of the request duration.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{le="0.05"} 24054
+http_request_duration_seconds_bucket{le="+Inf"} 144320
+http_request_duration_seconds_sum 53423
+http_request_duration_seconds_count 144320
+`
@@ -8,6 +8,18 @@ import (
 	"stator/entity"
 )
 
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+	helpUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n")
+
+	suffixes = map[string][]string{
+		"histogram": {"bucket", "sum", "count"},
+		"summary":   {"sum", "count"},
+	}
+)
+
 // Prometheus formats stats for consumption by Prometheus.
 //
 // For example:
@@ -64,12 +76,9 @@ func headerDatum(pa entity.PointsAt, idx int) (hdr, dtm string) {
 	pt := pa.Points[idx]
 	lbl := label(append(pa.Labels, pt.Labels...))
 
-	name := fmt.Sprintf("%s_%s", pa.Name, pt.Name)
-	if pt.Unit != "" {
-		name = fmt.Sprintf("%s_%s", name, pt.Unit)
-	}
+	name := join(pa.Name, pt.Name, pt.Unit)
 
-	hdr = header(name, pt)
+	hdr = header(family(name, pt.Type), pt)
 	dtm = fmt.Sprintf("%s{%s} %s %d\n", name, lbl, pt.Value, pa.Stamp.UnixMilli())
 	return
 }
@@ -79,7 +88,7 @@ func header(name string, pt entity.Point) string {
 	builder := &strings.Builder{}
 
 	fmt.Fprintf(builder, "\n")
-	fmt.Fprintf(builder, "# HELP %s %s\n", name, pt.Desc)
+	fmt.Fprintf(builder, "# HELP %s %s\n", name, helpEscaper.Replace(pt.Desc))
 	fmt.Fprintf(builder, "# TYPE %s %s\n", name, pt.Type)
 
 	return builder.String()
@@ -89,8 +98,36 @@ func label(labels entity.Labels) string {
 
 	strs := []string{}
 	for _, label := range labels {
-		strs = append(strs, fmt.Sprintf(`%s="%s"`, label.Key, label.Val))
+		strs = append(strs, fmt.Sprintf(`%s="%s"`, label.Key, labelEscaper.Replace(label.Val)))
 	}
 
 	return strings.Join(strs, ",")
 }
+
+func join(parts ...string) string {
+
+	// skipping blanks so that parsed points, which carry the whole name, format as found
+
+	nonBlank := []string{}
+	for _, part := range parts {
+		if part != "" {
+			nonBlank = append(nonBlank, part)
+		}
+	}
+
+	return strings.Join(nonBlank, "_")
+}
+
+func family(name, typ string) string {
+
+	// histogram and summary samples share a header named for the family
+
+	for _, suffix := range suffixes[typ] {
+		trimmed, ok := strings.CutSuffix(name, "_"+suffix)
+		if ok {
+			return trimmed
+		}
+	}
+
+	return name
+}
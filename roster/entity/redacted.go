@@ -0,0 +1,13 @@
+package entity
+
+// Redacted is a string kept out of logs when marshalled.
+type Redacted string
+
+// MarshalJSON marshals as "--redacted--" when not blank.
+func (rdc Redacted) MarshalJSON() ([]byte, error) {
+
+	if rdc == "" {
+		return []byte(`""`), nil
+	}
+	return []byte(`"--redacted--"`), nil
+}
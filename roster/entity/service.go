@@ -3,18 +3,62 @@ package entity
 import (
 	"fmt"
 	"net"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
+const (
+	Passing  string = "passing"
+	Warning  string = "warning"
+	Critical string = "critical"
+)
+
+var (
+	checkKinds = map[string]bool{"http": true, "tcp": true, "grpc": true, "ttl": true}
+	metaKey    = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+)
+
 type Service struct {
-	Id          string
-	Name        string
-	Tags        []string
-	IpAddress   string
-	Port        int
-	MonitorSpec string
+	Id                string
+	Name              string
+	Tags              []string
+	IpAddress         string
+	Port              int
+	MonitorSpec       string
+	Meta              map[string]string
+	Weights           Weights
+	EnableTagOverride bool
+	Checks            []Check
+}
+
+// Weights are relative weights for dns, zero for registrar's default.
+type Weights struct {
+	Passing int
+	Warning int
+}
+
+// Check is a health check in addition to the one at MonitorSpec.
+//
+// Target is a format spec taking ip address and port, such as "%s:%d" for tcp,
+// or "%s:%d/grpc.health.v1.Health" for grpc, and is not used for ttl.
+// A target without verbs, such as "db:5432", is used as is.
+// Interval is ttl for ttl checks.
+type Check struct {
+	Kind     string
+	Target   string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// TargetGroup is a Prometheus file or http sd target group.
+type TargetGroup struct {
+	Targets []string          `json:"targets" yaml:"targets"`
+	Labels  map[string]string `json:"labels" yaml:"labels"`
 }
 
 func (svc *Service) NameId() string {
@@ -22,6 +66,39 @@ func (svc *Service) NameId() string {
 	return fmt.Sprintf("%s-%s", svc.Name, svc.Id)
 }
 
+// TargetGroup returns the service as a target group labeled with service, service_id,
+// tags in the style of consul's (",dev,metrics,"), and meta_ prefixed metadata.
+func (svc *Service) TargetGroup() TargetGroup {
+
+	labels := map[string]string{
+		"service":    svc.Name,
+		"service_id": svc.NameId(),
+	}
+
+	if len(svc.Tags) > 0 {
+		labels["tags"] = "," + strings.Join(svc.Tags, ",") + ","
+	}
+
+	for key, val := range svc.Meta {
+		labels["meta_"+strings.ReplaceAll(key, "-", "_")] = val
+	}
+
+	return TargetGroup{
+		Targets: []string{net.JoinHostPort(svc.IpAddress, strconv.Itoa(svc.Port))},
+		Labels:  labels,
+	}
+}
+
+// Address returns Target formatted with ip address and port, or as is when it has no verbs.
+func (check Check) Address(ip string, port int) string {
+
+	if !strings.Contains(check.Target, "%") {
+		return check.Target
+	}
+
+	return fmt.Sprintf(check.Target, ip, port)
+}
+
 func (svc *Service) Valid() (err error) {
 
 	errs := []string{}
@@ -47,8 +124,43 @@ func (svc *Service) Valid() (err error) {
 		errs = append(errs, "MonitorSpec must not be blank")
 	}
 
+	keys := make([]string, 0, len(svc.Meta))
+	for key := range svc.Meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !metaKey.MatchString(key) {
+			errs = append(errs, fmt.Sprintf("Meta key %q must be 1 to 128 alphanumerics, dashes or underscores", key))
+		}
+	}
+
+	for i, check := range svc.Checks {
+		errs = append(errs, check.invalid(i)...)
+	}
+
 	if len(errs) != 0 {
 		err = errors.Errorf("invalid Service: %s", strings.Join(errs, ","))
 	}
 	return
 }
+
+// unexported
+
+func (check Check) invalid(idx int) (errs []string) {
+
+	if !checkKinds[check.Kind] {
+		errs = append(errs, fmt.Sprintf("Checks[%d] Kind must be one of http, tcp, grpc or ttl", idx))
+	}
+
+	if check.Kind != "ttl" && check.Target == "" {
+		errs = append(errs, fmt.Sprintf("Checks[%d] Target must not be blank", idx))
+	}
+
+	if check.Interval <= 0 {
+		errs = append(errs, fmt.Sprintf("Checks[%d] Interval must be positive", idx))
+	}
+
+	return
+}
@@ -2,6 +2,7 @@ package entity
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -44,6 +45,37 @@ var _ = Describe("Service", func() {
 		})
 	})
 
+	Describe("getting a check address", func() {
+		var (
+			check Check
+			addr  string
+		)
+
+		BeforeEach(func() {
+			check = Check{Kind: "tcp", Target: "%s:%d", Interval: time.Minute}
+		})
+
+		JustBeforeEach(func() {
+			addr = check.Address(svc.IpAddress, svc.Port)
+		})
+
+		When("target is a format spec", func() {
+			It("formats it with ip address and port", func() {
+				Expect(addr).To(Equal("1.2.3.4:8082"))
+			})
+		})
+
+		When("target has no verbs", func() {
+			BeforeEach(func() {
+				check.Target = "db:5432"
+			})
+
+			It("uses it as is", func() {
+				Expect(addr).To(Equal("db:5432"))
+			})
+		})
+	})
+
 	Describe("checking validity", func() {
 		var (
 			err error
@@ -59,6 +91,20 @@ var _ = Describe("Service", func() {
 			})
 		})
 
+		When("metadata and checks are invalid", func() {
+			BeforeEach(func() {
+				svc.Meta = map[string]string{"version": "1.2.3", "bad key": "x"}
+				svc.Checks = []Check{
+					{Kind: "tcp", Target: "%s:%d", Interval: time.Minute},
+					{Kind: "icmp"},
+				}
+			})
+
+			It("errors with the reasons", func() {
+				Expect(err).To(MatchError(`invalid Service: Meta key "bad key" must be 1 to 128 alphanumerics, dashes or underscores,Checks[1] Kind must be one of http, tcp, grpc or ttl,Checks[1] Target must not be blank,Checks[1] Interval must be positive`))
+			})
+		})
+
 		When("service is totally invalid", func() {
 			BeforeEach(func() {
 				svc = Service{}
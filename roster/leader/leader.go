@@ -0,0 +1,340 @@
+// Package leader elects a leader among instances of a service via a Consul session and KV lock.
+package leader
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clarktrimble/hondo"
+	"github.com/pkg/errors"
+
+	"stator/roster/entity"
+	"stator/roster/registrar/consul"
+)
+
+//go:generate moq -out mock_test.go . Client Logger
+
+const (
+	createPath  string = "/v1/session/create"
+	renewPath   string = "/v1/session/renew/%s"
+	destroyPath string = "/v1/session/destroy/%s"
+	kvPath      string = "/v1/kv/%s?%s"
+	kvGetPath   string = "/v1/kv/%s"
+)
+
+// Client specifies an http client.
+//
+// Pass a consul.Consul, so that sessions and kv are scoped by datacenter, namespace and
+// partition as is registration.
+type Client interface {
+	SendObject(ctx context.Context, method, path string, snd, rcv any) (err error)
+}
+
+// Logger specifies a logging interface.
+type Logger interface {
+	Info(ctx context.Context, msg string, kv ...any)
+	Error(ctx context.Context, msg string, err error, kv ...any)
+	WithFields(ctx context.Context, kv ...any) context.Context
+}
+
+// Config is Leader configuration.
+type Config struct {
+	Key        string        `json:"key" desc:"kv key to lock, such as service/stator/leader" required:"true"`
+	SessionTtl time.Duration `json:"session_ttl" desc:"session time to live, between 10s and 24h" default:"15s"`
+	LockDelay  time.Duration `json:"lock_delay" desc:"wait before lock can be re-acquired after session invalidation" default:"15s"`
+	Interval   time.Duration `json:"interval" desc:"session renewal and acquisition attempt period, well under ttl" default:"5s"`
+}
+
+// Leader contends for a Consul lock on Key, via a session tied to the service's primary
+// health check, as registered by the consul package.
+//
+// Consul invalidates the session, releasing the lock, when the check goes critical or
+// the session is not renewed within SessionTtl.
+// While leading, the lock is confirmed as still held by the session on each renewal,
+// stepping down otherwise or when it cannot be confirmed.
+// A session found invalid is forgotten and recreated on the next attempt, every Interval,
+// while one that could not be renewed for other reasons is renewed again.
+type Leader struct {
+	Client     Client
+	Logger     Logger
+	Service    entity.Service
+	Key        string
+	SessionTtl time.Duration
+	LockDelay  time.Duration
+	Interval   time.Duration
+
+	mu      sync.Mutex
+	session string
+	leader  bool
+	term    uint64
+	subs    []chan Leadership
+}
+
+// Leadership is leadership as of a term, counting changes of leadership.
+type Leadership struct {
+	Leader bool
+	Term   uint64
+}
+
+// New creates a Leader from Config.
+func (cfg *Config) New(client Client, svc entity.Service, lgr Logger) *Leader {
+
+	return &Leader{
+		Client:     client,
+		Logger:     lgr,
+		Service:    svc,
+		Key:        cfg.Key,
+		SessionTtl: cfg.SessionTtl,
+		LockDelay:  cfg.LockDelay,
+		Interval:   cfg.Interval,
+	}
+}
+
+// Start starts contending for leadership.
+func (ldr *Leader) Start(ctx context.Context, wg *sync.WaitGroup) {
+
+	ctx = ldr.Logger.WithFields(ctx, "worker_id", hondo.Rand(7))
+	ldr.Logger.Info(ctx, "worker starting", "name", "leader", "key", ldr.Key)
+
+	ldr.contend(ctx)
+
+	// adding here rather than in work, so that a prompt cancel and wait cannot miss it
+
+	wg.Add(1)
+	go ldr.work(ctx, wg)
+}
+
+// IsLeader returns true when holding the lock.
+func (ldr *Leader) IsLeader() bool {
+
+	return ldr.Leadership().Leader
+}
+
+// Leadership returns current leadership and term.
+func (ldr *Leader) Leadership() Leadership {
+
+	ldr.mu.Lock()
+	defer ldr.mu.Unlock()
+
+	return Leadership{Leader: ldr.leader, Term: ldr.term}
+}
+
+// Notify returns a channel receiving leadership on change.
+//
+// The channel is buffered by one with stale values dropped, so a slow receiver
+// sees the latest rather than blocking the election.
+// Term increases by one with each change, such that a jump of more than one
+// reveals changes dropped in between, as when leadership was lost and regained.
+func (ldr *Leader) Notify() <-chan Leadership {
+
+	ldr.mu.Lock()
+	defer ldr.mu.Unlock()
+
+	ch := make(chan Leadership, 1)
+	ldr.subs = append(ldr.subs, ch)
+
+	return ch
+}
+
+// unexported
+
+type sessionRequest struct {
+	Name      string
+	Checks    []string
+	TTL       string
+	LockDelay string
+	Behavior  string
+}
+
+type sessionResponse struct {
+	ID string
+}
+
+type kvEntry struct {
+	Session string
+}
+
+type lockValue struct {
+	ServiceId string `json:"service_id"`
+	Address   string `json:"address"`
+}
+
+func (ldr *Leader) work(ctx context.Context, wg *sync.WaitGroup) {
+
+	defer wg.Done()
+
+	ticker := time.NewTicker(ldr.Interval)
+
+	for {
+		select {
+		case <-ticker.C:
+			ldr.contend(ctx)
+
+		case <-ctx.Done():
+			ldr.Logger.Info(ctx, "worker shutting down")
+			ldr.release(context.WithoutCancel(ctx))
+			ldr.Logger.Info(ctx, "worker stopped")
+			return
+		}
+	}
+}
+
+func (ldr *Leader) contend(ctx context.Context) {
+
+	// renewing the session each round, confirming the lock when held and trying for it when not
+
+	session, err := ldr.renew(ctx)
+	if err != nil {
+		ldr.Logger.Error(ctx, "failed to maintain leader session", err)
+		ldr.set(ctx, session, false)
+		return
+	}
+
+	if ldr.IsLeader() {
+		held, err := ldr.holds(ctx, session)
+		if err != nil {
+			ldr.Logger.Error(ctx, "failed to confirm leader lock", err)
+		}
+		if !held {
+			ldr.set(ctx, session, false)
+		}
+		return
+	}
+
+	acquired, err := ldr.acquire(ctx, session)
+	if err != nil {
+		ldr.Logger.Error(ctx, "failed to acquire leader lock", err)
+	}
+	ldr.set(ctx, session, acquired)
+}
+
+func (ldr *Leader) renew(ctx context.Context) (session string, err error) {
+
+	ldr.mu.Lock()
+	session = ldr.session
+	ldr.mu.Unlock()
+
+	if session != "" {
+		err = ldr.Client.SendObject(ctx, "PUT", fmt.Sprintf(renewPath, session), nil, nil)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to renew session %s", session)
+			if invalid(err) {
+				session = ""
+			}
+		}
+		return
+	}
+
+	rq := sessionRequest{
+		Name:      fmt.Sprintf("%s leader", ldr.Service.NameId()),
+		Checks:    []string{"serfHealth", consul.PrimaryCheckId(ldr.Service)},
+		TTL:       ldr.SessionTtl.String(),
+		LockDelay: ldr.LockDelay.String(),
+		Behavior:  "release",
+	}
+	rs := sessionResponse{}
+
+	err = ldr.Client.SendObject(ctx, "PUT", createPath, rq, &rs)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to create session")
+		return
+	}
+	session = rs.ID
+
+	ldr.mu.Lock()
+	ldr.session = session
+	ldr.mu.Unlock()
+
+	return
+}
+
+func invalid(err error) bool {
+
+	// consul answers not found when renewing a session it has invalidated or never had
+
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "404") || strings.Contains(msg, "not found")
+}
+
+func (ldr *Leader) acquire(ctx context.Context, session string) (acquired bool, err error) {
+
+	value := lockValue{
+		ServiceId: ldr.Service.NameId(),
+		Address:   fmt.Sprintf("%s:%d", ldr.Service.IpAddress, ldr.Service.Port),
+	}
+	query := url.Values{"acquire": {session}}
+
+	err = ldr.Client.SendObject(ctx, "PUT", fmt.Sprintf(kvPath, ldr.Key, query.Encode()), value, &acquired)
+	return
+}
+
+func (ldr *Leader) holds(ctx context.Context, session string) (held bool, err error) {
+
+	entries := []kvEntry{}
+
+	err = ldr.Client.SendObject(ctx, "GET", fmt.Sprintf(kvGetPath, ldr.Key), nil, &entries)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to get %s", ldr.Key)
+		return
+	}
+
+	held = len(entries) > 0 && entries[0].Session == session
+	return
+}
+
+func (ldr *Leader) release(ctx context.Context) {
+
+	ldr.mu.Lock()
+	session := ldr.session
+	leader := ldr.leader
+	ldr.mu.Unlock()
+
+	if session == "" {
+		return
+	}
+
+	if leader {
+		var released bool
+		query := url.Values{"release": {session}}
+
+		err := ldr.Client.SendObject(ctx, "PUT", fmt.Sprintf(kvPath, ldr.Key, query.Encode()), nil, &released)
+		if err != nil {
+			ldr.Logger.Error(ctx, "failed to release leader lock", err)
+		}
+	}
+
+	err := ldr.Client.SendObject(ctx, "PUT", fmt.Sprintf(destroyPath, session), nil, nil)
+	if err != nil {
+		ldr.Logger.Error(ctx, "failed to destroy leader session", err)
+	}
+
+	ldr.set(ctx, "", false)
+}
+
+func (ldr *Leader) set(ctx context.Context, session string, leader bool) {
+
+	ldr.mu.Lock()
+	defer ldr.mu.Unlock()
+
+	ldr.session = session
+	if leader == ldr.leader {
+		return
+	}
+	ldr.leader = leader
+	ldr.term++
+
+	ldr.Logger.Info(ctx, "leadership changed", "leader", leader, "term", ldr.term, "key", ldr.Key)
+
+	lsp := Leadership{Leader: leader, Term: ldr.term}
+	for _, ch := range ldr.subs {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- lsp
+	}
+}
@@ -0,0 +1,351 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"stator/roster/entity"
+	"stator/roster/registrar/consul"
+)
+
+func TestLeader(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Leader Suite")
+}
+
+var _ = Describe("Leader", func() {
+	var (
+		fake   *fakeConsul
+		client *ClientMock
+		lgr    *LoggerMock
+		svc    entity.Service
+		ldr    *Leader
+		ctx    context.Context
+		cancel context.CancelFunc
+		wg     sync.WaitGroup
+	)
+
+	BeforeEach(func() {
+		fake = &fakeConsul{sessions: map[string]bool{}}
+		client = &ClientMock{
+			SendObjectFunc: fake.SendObject,
+		}
+		lgr = &LoggerMock{
+			InfoFunc:  func(ctx context.Context, msg string, kv ...any) {},
+			ErrorFunc: func(ctx context.Context, msg string, err error, kv ...any) {},
+			WithFieldsFunc: func(ctx context.Context, kv ...any) context.Context {
+				return ctx
+			},
+		}
+		svc = entity.Service{
+			Id:        "123",
+			Name:      "foobear",
+			IpAddress: "1.2.3.4",
+			Port:      8082,
+		}
+
+		ldr = (&Config{
+			Key:        "service/foobear/leader",
+			SessionTtl: 15 * time.Second,
+			LockDelay:  15 * time.Second,
+			Interval:   10 * time.Millisecond,
+		}).New(client, svc, lgr)
+
+		wg = sync.WaitGroup{}
+		ctx, cancel = context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+	})
+
+	Describe("creating a leader", func() {
+		It("creates one with client, service and cfg", func() {
+			Expect(ldr).To(Equal(&Leader{
+				Client:     client,
+				Logger:     lgr,
+				Service:    svc,
+				Key:        "service/foobear/leader",
+				SessionTtl: 15 * time.Second,
+				LockDelay:  15 * time.Second,
+				Interval:   10 * time.Millisecond,
+			}))
+		})
+	})
+
+	Describe("contending", func() {
+		var (
+			notes <-chan Leadership
+		)
+
+		JustBeforeEach(func() {
+			notes = ldr.Notify()
+			ldr.Start(ctx, &wg)
+		})
+
+		When("lock is free", func() {
+			It("creates a session tied to the service check, takes the lock and releases it on shutdown", func() {
+				Expect(ldr.IsLeader()).To(BeTrue())
+				Expect(notes).To(Receive(Equal(Leadership{Leader: true, Term: 1})))
+
+				Expect(fake.raw[0]).To(MatchJSON(`{
+					"Name": "foobear-123 leader",
+					"Checks": ["serfHealth", "service:foobear-123"],
+					"TTL": "15s",
+					"LockDelay": "15s",
+					"Behavior": "release"
+				}`))
+
+				soc := client.SendObjectCalls()
+				Expect(soc[1].Path).To(Equal("/v1/kv/service/foobear/leader?acquire=sess-1"))
+				Expect(fake.raw[1]).To(MatchJSON(`{"service_id": "foobear-123", "address": "1.2.3.4:8082"}`))
+
+				Eventually(func() int { return len(client.SendObjectCalls()) }).Should(BeNumerically(">=", 4))
+				Expect(client.SendObjectCalls()[2].Path).To(Equal("/v1/session/renew/sess-1"))
+				Expect(client.SendObjectCalls()[3].Path).To(Equal("/v1/kv/service/foobear/leader"))
+				Expect(ldr.IsLeader()).To(BeTrue())
+
+				cancel()
+				wg.Wait()
+
+				Expect(ldr.IsLeader()).To(BeFalse())
+				Expect(notes).To(Receive(Equal(Leadership{Leader: false, Term: 2})))
+				Expect(fake.holder).To(BeEmpty())
+				Expect(fake.sessions).To(BeEmpty())
+			})
+		})
+
+		When("lock is held elsewhere", func() {
+			BeforeEach(func() {
+				fake.holder = "other"
+			})
+
+			It("keeps trying until it comes free", func() {
+				Expect(ldr.IsLeader()).To(BeFalse())
+				Consistently(notes, "30ms").ShouldNot(Receive())
+
+				fake.free()
+				Eventually(notes).Should(Receive(Equal(Leadership{Leader: true, Term: 1})))
+				Expect(ldr.IsLeader()).To(BeTrue())
+
+				cancel()
+				wg.Wait()
+			})
+		})
+
+		When("session is invalidated", func() {
+			BeforeEach(func() {
+				// contending by hand, round by round
+				ldr.Interval = time.Hour
+			})
+
+			It("steps down and contends anew", func() {
+				Expect(notes).To(Receive(Equal(Leadership{Leader: true, Term: 1})))
+
+				fake.invalidate()
+
+				ldr.contend(ctx)
+				Expect(notes).To(Receive(Equal(Leadership{Leader: false, Term: 2})))
+				Expect(lgr.ErrorCalls()[0].Msg).To(Equal("failed to maintain leader session"))
+
+				ldr.contend(ctx)
+				Expect(notes).To(Receive(Equal(Leadership{Leader: true, Term: 3})))
+				Expect(fake.held()).To(Equal("sess-2"))
+
+				cancel()
+				wg.Wait()
+			})
+		})
+
+		When("session cannot be renewed for a moment", func() {
+			BeforeEach(func() {
+				ldr.Interval = time.Hour
+			})
+
+			It("steps down and renews the same session", func() {
+				Expect(notes).To(Receive(Equal(Leadership{Leader: true, Term: 1})))
+
+				client.SendObjectFunc = func(ctx context.Context, method, path string, snd, rcv any) error {
+					return fmt.Errorf("oops")
+				}
+
+				ldr.contend(ctx)
+				Expect(notes).To(Receive(Equal(Leadership{Leader: false, Term: 2})))
+				Expect(lgr.ErrorCalls()[0].Err).To(MatchError("failed to renew session sess-1: oops"))
+
+				client.SendObjectFunc = fake.SendObject
+
+				ldr.contend(ctx)
+				Expect(notes).To(Receive(Equal(Leadership{Leader: true, Term: 3})))
+				Expect(fake.held()).To(Equal("sess-1"))
+				Expect(fake.next).To(Equal(1))
+
+				soc := client.SendObjectCalls()
+				Expect(soc[len(soc)-2].Path).To(Equal("/v1/session/renew/sess-1"))
+
+				cancel()
+				wg.Wait()
+			})
+		})
+
+		When("lock is taken while leading", func() {
+			BeforeEach(func() {
+				ldr.Interval = time.Hour
+			})
+
+			It("steps down and keeps trying", func() {
+				Expect(notes).To(Receive(Equal(Leadership{Leader: true, Term: 1})))
+
+				fake.take("other")
+
+				ldr.contend(ctx)
+				Expect(notes).To(Receive(Equal(Leadership{Leader: false, Term: 2})))
+				Expect(ldr.Leadership()).To(Equal(Leadership{Leader: false, Term: 2}))
+
+				ldr.contend(ctx)
+				Expect(notes).ToNot(Receive())
+				Expect(fake.held()).To(Equal("other"))
+
+				cancel()
+				wg.Wait()
+			})
+		})
+
+		When("client is a scoped consul", func() {
+			BeforeEach(func() {
+				ldr.Client = (&consul.Config{Datacenter: "dc2", Namespace: "team"}).New(client)
+			})
+
+			It("scopes sessions and kv as does registration", func() {
+				Expect(ldr.IsLeader()).To(BeTrue())
+
+				soc := client.SendObjectCalls()
+				Expect(soc[0].Path).To(Equal("/v1/session/create?dc=dc2&ns=team"))
+				Expect(soc[1].Path).To(Equal("/v1/kv/service/foobear/leader?acquire=sess-1&dc=dc2&ns=team"))
+
+				cancel()
+				wg.Wait()
+
+				soc = client.SendObjectCalls()
+				Expect(soc[len(soc)-1].Path).To(Equal("/v1/session/destroy/sess-1?dc=dc2&ns=team"))
+			})
+		})
+
+		When("consul is unavailable", func() {
+			BeforeEach(func() {
+				client.SendObjectFunc = func(ctx context.Context, method, path string, snd, rcv any) error {
+					return fmt.Errorf("oops")
+				}
+			})
+
+			It("logs and does not lead", func() {
+				Expect(ldr.IsLeader()).To(BeFalse())
+				Expect(lgr.ErrorCalls()[0].Err).To(MatchError("failed to create session: oops"))
+
+				cancel()
+				wg.Wait()
+			})
+		})
+	})
+})
+
+// fakeConsul minimally mimics consul's session and kv lock api, round-tripping json as would the real client.
+type fakeConsul struct {
+	mu       sync.Mutex
+	sessions map[string]bool
+	holder   string
+	next     int
+	raw      []string
+}
+
+func (fake *fakeConsul) SendObject(ctx context.Context, method, path string, snd, rcv any) (err error) {
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	data, err := json.Marshal(snd)
+	if err != nil {
+		return
+	}
+	fake.raw = append(fake.raw, string(data))
+
+	path, raw, _ := strings.Cut(path, "?")
+	query, err := url.ParseQuery(raw)
+	if err != nil {
+		return
+	}
+
+	var rs string
+	switch {
+	case path == createPath:
+		fake.next++
+		id := fmt.Sprintf("sess-%d", fake.next)
+		fake.sessions[id] = true
+		rs = fmt.Sprintf(`{"ID":%q}`, id)
+	case strings.HasPrefix(path, "/v1/session/renew/"):
+		if !fake.sessions[strings.TrimPrefix(path, "/v1/session/renew/")] {
+			return fmt.Errorf("unexpected status 404")
+		}
+	case strings.HasPrefix(path, "/v1/session/destroy/"):
+		delete(fake.sessions, strings.TrimPrefix(path, "/v1/session/destroy/"))
+	case query.Has("acquire"):
+		id := query.Get("acquire")
+		rs = "false"
+		if (fake.holder == "" || fake.holder == id) && fake.sessions[id] {
+			fake.holder = id
+			rs = "true"
+		}
+	case method == "GET":
+		rs = fmt.Sprintf(`[{"Session":%q}]`, fake.holder)
+	case query.Has("release"):
+		rs = "false"
+		if fake.holder == query.Get("release") {
+			fake.holder = ""
+			rs = "true"
+		}
+	}
+
+	if rcv != nil {
+		err = json.Unmarshal([]byte(rs), rcv)
+	}
+	return
+}
+
+func (fake *fakeConsul) free() {
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.holder = ""
+}
+
+func (fake *fakeConsul) take(holder string) {
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.holder = holder
+}
+
+func (fake *fakeConsul) invalidate() {
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.sessions = map[string]bool{}
+	fake.holder = ""
+}
+
+func (fake *fakeConsul) held() string {
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return fake.holder
+}
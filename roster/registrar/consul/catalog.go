@@ -0,0 +1,304 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"stator/roster/entity"
+)
+
+const (
+	catalogRegisterPath   string = "/v1/catalog/register"
+	catalogDeregisterPath string = "/v1/catalog/deregister"
+	catalogServicePath    string = "/v1/catalog/service/%s?%s"
+)
+
+// CatalogConfig is Catalog configuration.
+type CatalogConfig struct {
+	Node              string            `json:"node" desc:"node name to register under, hostname when blank"`
+	NodeMeta          map[string]string `json:"node_meta" desc:"node metadata as key:value pairs"`
+	HeartbeatInterval time.Duration     `json:"heartbeat_interval" desc:"health status change detection period" default:"10s"`
+}
+
+// Catalog registers directly with the catalog of a remote Consul server, for hosts
+// without an agent of their own.
+//
+// With no agent to run them, checks are not polled by consul. Instead, the service's
+// checks are registered along with it and their status updated via Heartbeat, which
+// writes to the catalog only when the status or note has changed.
+// Additional checks are registered with their definitions for the record, but share
+// the reported status.
+// Nothing expires an abandoned registration, so the last status reported stands
+// should we stop without unregistering.
+type Catalog struct {
+	Client            Client
+	Node              string
+	NodeMeta          map[string]string
+	HeartbeatInterval time.Duration
+	Datacenter        string
+	Namespace         string
+	Partition         string
+
+	mu     sync.Mutex
+	health map[string]health
+}
+
+// New creates a Catalog from Config, scoped to the datacenter, namespace and partition of scope.
+func (cfg *CatalogConfig) New(client Client, scope *Config) *Catalog {
+
+	node := cfg.Node
+	if node == "" {
+		node, _ = os.Hostname()
+	}
+
+	return &Catalog{
+		Client:            client,
+		Node:              node,
+		NodeMeta:          cfg.NodeMeta,
+		HeartbeatInterval: cfg.HeartbeatInterval,
+		Datacenter:        scope.Datacenter,
+		Namespace:         scope.Namespace,
+		Partition:         scope.Partition,
+		health:            map[string]health{},
+	}
+}
+
+// Register registers the node, service and its check, with the status last reported
+// via Heartbeat, or passing.
+func (ctl *Catalog) Register(ctx context.Context, svc entity.Service) (err error) {
+
+	ctl.mu.Lock()
+	hlth, ok := ctl.health[svc.NameId()]
+	ctl.mu.Unlock()
+
+	if !ok {
+		hlth = health{status: entity.Passing}
+	}
+
+	err = ctl.register(ctx, svc, hlth)
+	return
+}
+
+// Unregister deregisters the service, along with its check, leaving the node.
+func (ctl *Catalog) Unregister(ctx context.Context, svc entity.Service) (err error) {
+
+	rq := catalogDeregister{
+		Node:      ctl.Node,
+		ServiceID: svc.NameId(),
+	}
+
+	ctl.mu.Lock()
+	delete(ctl.health, svc.NameId())
+	ctl.mu.Unlock()
+
+	err = ctl.send(ctx, "PUT", catalogDeregisterPath, rq, nil)
+	return
+}
+
+// Registered checks that the service is in the catalog under our node.
+func (ctl *Catalog) Registered(ctx context.Context, svc entity.Service) (ok bool, err error) {
+
+	query := url.Values{}
+	query.Set("filter", fmt.Sprintf("ServiceID == %q and Node == %q", svc.NameId(), ctl.Node))
+
+	found := []map[string]any{}
+
+	err = ctl.send(ctx, "GET", fmt.Sprintf(catalogServicePath, url.PathEscape(svc.Name), query.Encode()), nil, &found)
+	if err != nil {
+		return
+	}
+
+	ok = len(found) > 0
+	return
+}
+
+// HeartbeatPeriod returns the period at which Heartbeat is to be called.
+func (ctl *Catalog) HeartbeatPeriod(svc entity.Service) time.Duration {
+
+	return ctl.HeartbeatInterval
+}
+
+// Heartbeat updates the status of the service's checks, skipping the write when
+// unchanged from that last reported.
+func (ctl *Catalog) Heartbeat(ctx context.Context, svc entity.Service, status, note string) (err error) {
+
+	_, ok := checkActions[status]
+	if !ok {
+		err = errors.Errorf("unknown check status: %s", status)
+		return
+	}
+
+	hlth := health{status: status, note: note}
+
+	ctl.mu.Lock()
+	last, ok := ctl.health[svc.NameId()]
+	ctl.mu.Unlock()
+
+	if !ok {
+		last = health{status: entity.Passing}
+	}
+	if hlth == last {
+		return
+	}
+
+	rq := catalogRegister{
+		Node:           ctl.Node,
+		Address:        svc.IpAddress,
+		SkipNodeUpdate: true,
+		Checks:         ctl.checks(svc, hlth),
+	}
+
+	err = ctl.send(ctx, "PUT", catalogRegisterPath, rq, nil)
+	if err != nil {
+		return
+	}
+
+	// recorded once sent, so that a failed update is retried on the next heartbeat
+
+	ctl.mu.Lock()
+	if ctl.health == nil {
+		ctl.health = map[string]health{}
+	}
+	ctl.health[svc.NameId()] = hlth
+	ctl.mu.Unlock()
+
+	return
+}
+
+// unexported
+
+type health struct {
+	status string
+	note   string
+}
+
+type catalogService struct {
+	ID                string
+	Service           string
+	Tags              []string
+	Address           string
+	Port              int
+	Meta              map[string]string `json:",omitempty"`
+	Weights           *weights          `json:",omitempty"`
+	EnableTagOverride bool              `json:",omitempty"`
+}
+
+type catalogDefinition struct {
+	HTTP     string `json:",omitempty"`
+	TCP      string `json:",omitempty"`
+	GRPC     string `json:",omitempty"`
+	Interval string `json:",omitempty"`
+	Timeout  string `json:",omitempty"`
+}
+
+type catalogCheck struct {
+	Node       string
+	CheckID    string
+	Name       string
+	Status     string
+	ServiceID  string
+	Output     string             `json:",omitempty"`
+	Definition *catalogDefinition `json:",omitempty"`
+}
+
+type catalogRegister struct {
+	Node           string
+	Address        string
+	NodeMeta       map[string]string `json:",omitempty"`
+	SkipNodeUpdate bool              `json:",omitempty"`
+	Service        *catalogService   `json:",omitempty"`
+	Checks         []catalogCheck
+}
+
+type catalogDeregister struct {
+	Node      string
+	ServiceID string
+}
+
+func (ctl *Catalog) register(ctx context.Context, svc entity.Service, hlth health) (err error) {
+
+	rq := catalogRegister{
+		Node:     ctl.Node,
+		Address:  svc.IpAddress,
+		NodeMeta: ctl.NodeMeta,
+		Service: &catalogService{
+			ID:                svc.NameId(),
+			Service:           svc.Name,
+			Tags:              svc.Tags,
+			Address:           svc.IpAddress,
+			Port:              svc.Port,
+			Meta:              svc.Meta,
+			EnableTagOverride: svc.EnableTagOverride,
+		},
+		Checks: ctl.checks(svc, hlth),
+	}
+
+	if svc.Weights != (entity.Weights{}) {
+		rq.Service.Weights = &weights{
+			Passing: svc.Weights.Passing,
+			Warning: svc.Weights.Warning,
+		}
+	}
+
+	err = ctl.send(ctx, "PUT", catalogRegisterPath, rq, nil)
+	return
+}
+
+func (ctl *Catalog) checks(svc entity.Service, hlth health) (checks []catalogCheck) {
+
+	checks = append(checks, catalogCheck{
+		Node:      ctl.Node,
+		CheckID:   checkId(svc, 0),
+		Name:      fmt.Sprintf("Service '%s' check", svc.Name),
+		Status:    hlth.status,
+		ServiceID: svc.NameId(),
+		Output:    hlth.note,
+	})
+
+	for i, sc := range svc.Checks {
+
+		chk := catalogCheck{
+			Node:      ctl.Node,
+			CheckID:   checkId(svc, i+2),
+			Name:      fmt.Sprintf("Service '%s' %s check", svc.Name, sc.Kind),
+			Status:    hlth.status,
+			ServiceID: svc.NameId(),
+			Output:    hlth.note,
+		}
+
+		if sc.Kind != "ttl" {
+			target := sc.Address(svc.IpAddress, svc.Port)
+			chk.Definition = &catalogDefinition{Interval: sc.Interval.String()}
+			if sc.Timeout > 0 {
+				chk.Definition.Timeout = sc.Timeout.String()
+			}
+
+			switch sc.Kind {
+			case "http":
+				chk.Definition.HTTP = target
+			case "tcp":
+				chk.Definition.TCP = target
+			case "grpc":
+				chk.Definition.GRPC = target
+			}
+		}
+
+		checks = append(checks, chk)
+	}
+
+	return
+}
+
+func (ctl *Catalog) send(ctx context.Context, method, path string, snd, rcv any) (err error) {
+
+	path = scoped(path, ctl.Datacenter, ctl.Namespace, ctl.Partition)
+
+	err = ctl.Client.SendObject(ctx, method, path, snd, rcv)
+	return
+}
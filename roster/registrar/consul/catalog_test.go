@@ -0,0 +1,283 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"stator/roster/entity"
+)
+
+var _ = Describe("Catalog", func() {
+	var (
+		client *ClientMock
+		ctl    *Catalog
+		ctx    context.Context
+		svc    entity.Service
+		err    error
+	)
+
+	BeforeEach(func() {
+		client = &ClientMock{
+			SendObjectFunc: func(ctx context.Context, method string, path string, snd any, rcv any) error {
+				return nil
+			},
+		}
+
+		ctl = (&CatalogConfig{
+			Node:              "appliance-1",
+			NodeMeta:          map[string]string{"external-node": "true"},
+			HeartbeatInterval: 10 * time.Second,
+		}).New(client, &Config{Datacenter: "dc2"})
+
+		ctx = context.Background()
+		svc = entity.Service{
+			Id:          "123",
+			Name:        "foobear",
+			Tags:        []string{"one", "two"},
+			IpAddress:   "1.2.3.4",
+			Port:        8082,
+			MonitorSpec: "http://%s:%d/monitor",
+		}
+	})
+
+	Describe("creating a catalog registrar", func() {
+
+		When("node is blank", func() {
+			It("defaults to hostname", func() {
+				Expect((&CatalogConfig{}).New(client, &Config{}).Node).ToNot(BeEmpty())
+			})
+		})
+	})
+
+	Describe("registering", func() {
+
+		JustBeforeEach(func() {
+			err = ctl.Register(ctx, svc)
+		})
+
+		When("all goes well", func() {
+			It("registers node, service and passing check with the catalog", func() {
+				Expect(err).ToNot(HaveOccurred())
+
+				soc := client.SendObjectCalls()
+				Expect(soc).To(HaveLen(1))
+				Expect(soc[0].Method).To(Equal("PUT"))
+				Expect(soc[0].Path).To(Equal("/v1/catalog/register?dc=dc2"))
+				Expect(soc[0].Snd).To(Equal(catalogRegister{
+					Node:     "appliance-1",
+					Address:  "1.2.3.4",
+					NodeMeta: map[string]string{"external-node": "true"},
+					Service: &catalogService{
+						ID:      "foobear-123",
+						Service: "foobear",
+						Tags:    []string{"one", "two"},
+						Address: "1.2.3.4",
+						Port:    8082,
+					},
+					Checks: []catalogCheck{{
+						Node:      "appliance-1",
+						CheckID:   "service:foobear-123",
+						Name:      "Service 'foobear' check",
+						Status:    "passing",
+						ServiceID: "foobear-123",
+					}},
+				}))
+			})
+		})
+
+		When("service has weights, tag override and additional checks", func() {
+			BeforeEach(func() {
+				svc.Weights = entity.Weights{Passing: 10, Warning: 1}
+				svc.EnableTagOverride = true
+				svc.Checks = []entity.Check{
+					{Kind: "tcp", Target: "%s:%d", Interval: time.Minute, Timeout: time.Second},
+					{Kind: "ttl", Interval: time.Minute},
+				}
+			})
+
+			It("registers them as well", func() {
+				Expect(err).ToNot(HaveOccurred())
+
+				rq, ok := client.SendObjectCalls()[0].Snd.(catalogRegister)
+				Expect(ok).To(BeTrue())
+				Expect(rq.Service.Weights).To(Equal(&weights{Passing: 10, Warning: 1}))
+				Expect(rq.Service.EnableTagOverride).To(BeTrue())
+				Expect(rq.Checks).To(HaveLen(3))
+				Expect(rq.Checks[1].CheckID).To(Equal("service:foobear-123:2"))
+				Expect(rq.Checks[1].Definition).To(Equal(&catalogDefinition{TCP: "1.2.3.4:8082", Interval: "1m0s", Timeout: "1s"}))
+				Expect(rq.Checks[2].CheckID).To(Equal("service:foobear-123:3"))
+				Expect(rq.Checks[2].Definition).To(BeNil())
+			})
+		})
+
+		When("health has been reported", func() {
+			BeforeEach(func() {
+				Expect(ctl.Heartbeat(ctx, svc, "warning", "1 of 3 collectors failed")).To(Succeed())
+			})
+
+			It("re-registers with the last status", func() {
+				Expect(err).ToNot(HaveOccurred())
+
+				soc := client.SendObjectCalls()
+				Expect(soc).To(HaveLen(2))
+
+				rq, ok := soc[1].Snd.(catalogRegister)
+				Expect(ok).To(BeTrue())
+				Expect(rq.Service).ToNot(BeNil())
+				Expect(rq.Checks[0].Status).To(Equal("warning"))
+				Expect(rq.Checks[0].Output).To(Equal("1 of 3 collectors failed"))
+			})
+		})
+
+		When("client has trouble", func() {
+			BeforeEach(func() {
+				client.SendObjectFunc = func(ctx context.Context, method string, path string, snd any, rcv any) error {
+					return fmt.Errorf("oops")
+				}
+			})
+
+			It("relays the error", func() {
+				Expect(err).To(MatchError("oops"))
+			})
+		})
+	})
+
+	Describe("heartbeating", func() {
+		var (
+			status string
+			note   string
+		)
+
+		BeforeEach(func() {
+			status = "critical"
+			note = "all collectors failed"
+		})
+
+		JustBeforeEach(func() {
+			err = ctl.Heartbeat(ctx, svc, status, note)
+		})
+
+		When("all goes well", func() {
+			It("updates only the check status via the catalog", func() {
+				Expect(err).ToNot(HaveOccurred())
+
+				soc := client.SendObjectCalls()
+				Expect(soc).To(HaveLen(1))
+				Expect(soc[0].Path).To(Equal("/v1/catalog/register?dc=dc2"))
+
+				rq, ok := soc[0].Snd.(catalogRegister)
+				Expect(ok).To(BeTrue())
+				Expect(rq.SkipNodeUpdate).To(BeTrue())
+				Expect(rq.Service).To(BeNil())
+				Expect(rq.Checks[0].Status).To(Equal("critical"))
+				Expect(rq.Checks[0].Output).To(Equal("all collectors failed"))
+			})
+		})
+
+		When("status is unchanged", func() {
+			BeforeEach(func() {
+				Expect(ctl.Heartbeat(ctx, svc, "critical", "all collectors failed")).To(Succeed())
+			})
+
+			It("skips the write", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(client.SendObjectCalls()).To(HaveLen(1))
+			})
+		})
+
+		When("status is as yet unreported passing", func() {
+			BeforeEach(func() {
+				status = "passing"
+				note = ""
+			})
+
+			It("skips the write", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(client.SendObjectCalls()).To(BeEmpty())
+			})
+		})
+
+		When("the update fails", func() {
+			BeforeEach(func() {
+				client.SendObjectFunc = func(ctx context.Context, method string, path string, snd any, rcv any) error {
+					return fmt.Errorf("oops")
+				}
+			})
+
+			It("retries on the next heartbeat", func() {
+				Expect(err).To(MatchError("oops"))
+				Expect(ctl.Heartbeat(ctx, svc, status, note)).To(MatchError("oops"))
+				Expect(client.SendObjectCalls()).To(HaveLen(2))
+			})
+		})
+
+		When("status is unknown", func() {
+			BeforeEach(func() {
+				status = "bargle"
+			})
+
+			It("errors without calling the client", func() {
+				Expect(err).To(MatchError("unknown check status: bargle"))
+				Expect(client.SendObjectCalls()).To(BeEmpty())
+			})
+		})
+
+		It("has the heartbeat period", func() {
+			Expect(ctl.HeartbeatPeriod(svc)).To(Equal(10 * time.Second))
+		})
+	})
+
+	Describe("verifying", func() {
+		var (
+			ok bool
+		)
+
+		BeforeEach(func() {
+			client.SendObjectFunc = func(ctx context.Context, method string, path string, snd any, rcv any) error {
+				found, _ := rcv.(*[]map[string]any)
+				*found = []map[string]any{{"ServiceID": "foobear-123"}}
+				return nil
+			}
+		})
+
+		JustBeforeEach(func() {
+			ok, err = ctl.Registered(ctx, svc)
+		})
+
+		When("registered", func() {
+			It("finds the service under our node", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ok).To(BeTrue())
+
+				soc := client.SendObjectCalls()
+				Expect(soc[0].Method).To(Equal("GET"))
+				Expect(soc[0].Path).To(Equal(
+					"/v1/catalog/service/foobear?filter=ServiceID+%3D%3D+%22foobear-123%22+and+Node+%3D%3D+%22appliance-1%22&dc=dc2",
+				))
+			})
+		})
+	})
+
+	Describe("unregistering", func() {
+
+		JustBeforeEach(func() {
+			err = ctl.Unregister(ctx, svc)
+		})
+
+		When("all goes well", func() {
+			It("deregisters the service, leaving the node", func() {
+				Expect(err).ToNot(HaveOccurred())
+
+				soc := client.SendObjectCalls()
+				Expect(soc).To(HaveLen(1))
+				Expect(soc[0].Method).To(Equal("PUT"))
+				Expect(soc[0].Path).To(Equal("/v1/catalog/deregister?dc=dc2"))
+				Expect(soc[0].Snd).To(Equal(catalogDeregister{Node: "appliance-1", ServiceID: "foobear-123"}))
+			})
+		})
+	})
+})
@@ -4,16 +4,35 @@ package consul
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"stator/roster/entity"
 )
 
-//go:generate moq -out mock_test.go . Client
+//go:generate moq -out mock_test.go . Client Indexer Logger
 
 const (
 	registerPath   string = "/v1/agent/service/register"
 	unregisterPath string = "/v1/agent/service/deregister/%s"
+	checkPath      string = "/v1/agent/check/%s/%s?%s"
+	servicesPath   string = "/v1/agent/services?%s"
+	maintPath      string = "/v1/agent/service/maintenance/%s?%s"
+
+	ttlMode string = "ttl"
+)
+
+var (
+	checkActions = map[string]string{
+		entity.Passing:  "pass",
+		entity.Warning:  "warn",
+		entity.Critical: "fail",
+	}
 )
 
 // Client specifies an http client.
@@ -23,76 +42,329 @@ type Client interface {
 
 // Config is Consul configuration.
 type Config struct {
-	CheckInterval   time.Duration `json:"check_interval" desc:"health check period" default:"1m"`
-	CheckTimeout    time.Duration `json:"check_timeout" desc:"health check timeout" default:"10s"`
-	DeregisterAfter time.Duration `json:"deregister_after" desc:"deregister after failed check period" default:"30m"`
+	CheckInterval     time.Duration   `json:"check_interval" desc:"health check period" default:"1m"`
+	CheckTimeout      time.Duration   `json:"check_timeout" desc:"health check timeout" default:"10s"`
+	DeregisterAfter   time.Duration   `json:"deregister_after" desc:"deregister after failed check period" default:"30m"`
+	CheckMode         string          `json:"check_mode" desc:"health check mode, http polled by consul or ttl heartbeat" default:"http"`
+	CheckTtl          time.Duration   `json:"check_ttl" desc:"ttl check expiry" default:"30s"`
+	HeartbeatInterval time.Duration   `json:"heartbeat_interval" desc:"ttl check heartbeat period" default:"10s"`
+	Token             entity.Redacted `json:"token" desc:"acl token"`
+	TokenFile         string          `json:"token_file" desc:"file holding acl token, re-read on change, taking precedence over token"`
+	Datacenter        string          `json:"datacenter" desc:"datacenter, agent's own when blank"`
+	Namespace         string          `json:"namespace" desc:"namespace, enterprise only"`
+	Partition         string          `json:"partition" desc:"admin partition, enterprise only"`
 }
 
 // Consul is a Consul client.
+//
+// Datacenter, Namespace and Partition are added as query parameters to every request,
+// while the acl token is set as a header by TokenRt, wrapped into Client.
 type Consul struct {
-	Client          Client
-	CheckInterval   time.Duration
-	CheckTimeout    time.Duration
-	DeregisterAfter time.Duration
+	Client            Client
+	CheckInterval     time.Duration
+	CheckTimeout      time.Duration
+	DeregisterAfter   time.Duration
+	CheckMode         string
+	CheckTtl          time.Duration
+	HeartbeatInterval time.Duration
+	Datacenter        string
+	Namespace         string
+	Partition         string
 }
 
 // New creates a Consul from Config.
 func (cfg *Config) New(client Client) *Consul {
 
 	return &Consul{
-		Client:          client,
-		CheckInterval:   cfg.CheckInterval,
-		CheckTimeout:    cfg.CheckTimeout,
-		DeregisterAfter: cfg.DeregisterAfter,
+		Client:            client,
+		CheckInterval:     cfg.CheckInterval,
+		CheckTimeout:      cfg.CheckTimeout,
+		DeregisterAfter:   cfg.DeregisterAfter,
+		CheckMode:         cfg.CheckMode,
+		CheckTtl:          cfg.CheckTtl,
+		HeartbeatInterval: cfg.HeartbeatInterval,
+		Datacenter:        cfg.Datacenter,
+		Namespace:         cfg.Namespace,
+		Partition:         cfg.Partition,
+	}
+}
+
+// Tripper creates a TokenRt from Config, for wrapping into the client passed to New.
+func (cfg *Config) Tripper(lgr Logger) *TokenRt {
+
+	return &TokenRt{
+		Token: &Token{
+			Value: string(cfg.Token),
+			File:  cfg.TokenFile,
+		},
+		Logger: lgr,
+	}
+}
+
+// NewIndexed creates an Indexed from Config, scoped as is Consul and sharing a tripper's
+// token with the client passed to New.
+func (cfg *Config) NewIndexed(baseUri string, tripper *TokenRt) *Indexed {
+
+	return &Indexed{
+		BaseUri:    baseUri,
+		Client:     &http.Client{Transport: &TokenRt{Token: tripper.Token, Logger: tripper.Logger}},
+		Datacenter: cfg.Datacenter,
+		Namespace:  cfg.Namespace,
+		Partition:  cfg.Partition,
 	}
 }
 
 // Register registers the service.
 func (csl *Consul) Register(ctx context.Context, svc entity.Service) (err error) {
 
-	// Note: registering with agent, catalog register is another kettle of fish
+	// Note: registering with agent, see Catalog for registering without one
 
 	reg := register{
-		ID:      svc.NameId(),
-		Name:    svc.Name,
-		Tags:    svc.Tags,
-		Address: svc.IpAddress,
-		Port:    svc.Port,
-		Check: check{
-			HTTP:                           fmt.Sprintf(svc.MonitorSpec, svc.IpAddress, svc.Port),
-			Interval:                       csl.CheckInterval.String(),
-			Timeout:                        csl.CheckTimeout.String(),
-			DeregisterCriticalServiceAfter: csl.DeregisterAfter.String(),
-			Status:                         "passing",
-		},
+		ID:                svc.NameId(),
+		Name:              svc.Name,
+		Tags:              svc.Tags,
+		Address:           svc.IpAddress,
+		Port:              svc.Port,
+		Meta:              svc.Meta,
+		EnableTagOverride: svc.EnableTagOverride,
+		Check:             csl.check(svc),
+		Checks:            csl.checks(svc),
+	}
+
+	if svc.Weights != (entity.Weights{}) {
+		reg.Weights = &weights{
+			Passing: svc.Weights.Passing,
+			Warning: svc.Weights.Warning,
+		}
+	}
+
+	err = csl.send(ctx, "PUT", registerPath, reg, nil)
+	return
+}
+
+// Registered checks that the service is registered with the agent.
+func (csl *Consul) Registered(ctx context.Context, svc entity.Service) (ok bool, err error) {
+
+	query := url.Values{}
+	query.Set("filter", fmt.Sprintf("ID == %q", svc.NameId()))
+
+	found := map[string]any{}
+
+	err = csl.send(ctx, "GET", fmt.Sprintf(servicesPath, query.Encode()), nil, &found)
+	if err != nil {
+		return
 	}
 
-	err = csl.Client.SendObject(ctx, "PUT", registerPath, reg, nil)
+	ok = len(found) > 0
+	return
+}
+
+// HeartbeatPeriod returns the period at which Heartbeat is to be called, zero when svc has no ttl checks.
+func (csl *Consul) HeartbeatPeriod(svc entity.Service) time.Duration {
+
+	if len(csl.ttlIds(svc)) == 0 {
+		return 0
+	}
+
+	return csl.HeartbeatInterval
+}
+
+// Heartbeat updates the service's ttl checks with status and note.
+func (csl *Consul) Heartbeat(ctx context.Context, svc entity.Service, status, note string) (err error) {
+
+	action, ok := checkActions[status]
+	if !ok {
+		err = errors.Errorf("unknown check status: %s", status)
+		return
+	}
+
+	query := url.Values{}
+	query.Set("note", note)
+
+	for _, id := range csl.ttlIds(svc) {
+		err = csl.send(ctx, "PUT", fmt.Sprintf(checkPath, action, id, query.Encode()), nil, nil)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Maintenance enables or disables maintenance mode, in which consul reports the service
+// as critical and so out of rotation, without unregistering it.
+func (csl *Consul) Maintenance(ctx context.Context, svc entity.Service, enable bool, reason string) (err error) {
+
+	query := url.Values{}
+	query.Set("enable", strconv.FormatBool(enable))
+	if reason != "" {
+		query.Set("reason", reason)
+	}
+
+	err = csl.send(ctx, "PUT", fmt.Sprintf(maintPath, svc.NameId(), query.Encode()), nil, nil)
 	return
 }
 
 // Unregister deregisters the service.
 func (csl *Consul) Unregister(ctx context.Context, svc entity.Service) (err error) {
 
-	err = csl.Client.SendObject(ctx, "PUT", fmt.Sprintf(unregisterPath, svc.NameId()), nil, nil)
+	err = csl.send(ctx, "PUT", fmt.Sprintf(unregisterPath, svc.NameId()), nil, nil)
+	return
+}
+
+// SendObject sends via Client scoped by Datacenter, Namespace and Partition, for sharing
+// with others talking to consul, such as leader.
+func (csl *Consul) SendObject(ctx context.Context, method, path string, snd, rcv any) (err error) {
+
+	err = csl.send(ctx, method, path, snd, rcv)
 	return
 }
 
+// PrimaryCheckId returns the id of the service's primary check, as registered by Consul or Catalog.
+func PrimaryCheckId(svc entity.Service) string {
+
+	return checkId(svc, 0)
+}
+
 // unexported
 
+func (csl *Consul) send(ctx context.Context, method, path string, snd, rcv any) (err error) {
+
+	path = scoped(path, csl.Datacenter, csl.Namespace, csl.Partition)
+
+	err = csl.Client.SendObject(ctx, method, path, snd, rcv)
+	return
+}
+
+func scoped(path, dc, ns, partition string) string {
+
+	query := url.Values{}
+	for key, val := range map[string]string{"dc": dc, "ns": ns, "partition": partition} {
+		if val != "" {
+			query.Set(key, val)
+		}
+	}
+
+	if len(query) == 0 {
+		return path
+	}
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + query.Encode()
+}
+
+func (csl *Consul) check(svc entity.Service) check {
+
+	if csl.CheckMode == ttlMode {
+		return check{
+			CheckID:                        checkId(svc, 0),
+			TTL:                            csl.CheckTtl.String(),
+			DeregisterCriticalServiceAfter: csl.DeregisterAfter.String(),
+			Status:                         entity.Passing,
+		}
+	}
+
+	return check{
+		CheckID:                        checkId(svc, 0),
+		HTTP:                           fmt.Sprintf(svc.MonitorSpec, svc.IpAddress, svc.Port),
+		Interval:                       csl.CheckInterval.String(),
+		Timeout:                        csl.CheckTimeout.String(),
+		DeregisterCriticalServiceAfter: csl.DeregisterAfter.String(),
+		Status:                         entity.Passing,
+	}
+}
+
+func (csl *Consul) checks(svc entity.Service) (checks []check) {
+
+	for i, sc := range svc.Checks {
+
+		chk := check{
+			CheckID:                        checkId(svc, i+2),
+			DeregisterCriticalServiceAfter: csl.DeregisterAfter.String(),
+			Status:                         entity.Passing,
+		}
+
+		target := sc.Address(svc.IpAddress, svc.Port)
+		switch sc.Kind {
+		case "http":
+			chk.HTTP = target
+		case "tcp":
+			chk.TCP = target
+		case "grpc":
+			chk.GRPC = target
+		case "ttl":
+			chk.TTL = sc.Interval.String()
+		}
+
+		if sc.Kind != "ttl" {
+			chk.Interval = sc.Interval.String()
+			if sc.Timeout > 0 {
+				chk.Timeout = sc.Timeout.String()
+			}
+		}
+
+		checks = append(checks, chk)
+	}
+
+	return
+}
+
+func (csl *Consul) ttlIds(svc entity.Service) (ids []string) {
+
+	if csl.CheckMode == ttlMode {
+		ids = append(ids, checkId(svc, 0))
+	}
+
+	for i, sc := range svc.Checks {
+		if sc.Kind == "ttl" {
+			ids = append(ids, checkId(svc, i+2))
+		}
+	}
+
+	return
+}
+
+func checkId(svc entity.Service, num int) string {
+
+	// set explicitly for every check, as consul's defaults number the primary check
+	// when there are others, so the primary is unnumbered and the others follow from two
+
+	if num == 0 {
+		return fmt.Sprintf("service:%s", svc.NameId())
+	}
+
+	return fmt.Sprintf("service:%s:%d", svc.NameId(), num)
+}
+
 type check struct {
+	CheckID                        string `json:",omitempty"`
 	Status                         string
-	HTTP                           string
-	Interval                       string
-	Timeout                        string
+	HTTP                           string `json:",omitempty"`
+	TCP                            string `json:",omitempty"`
+	GRPC                           string `json:",omitempty"`
+	TTL                            string `json:",omitempty"`
+	Interval                       string `json:",omitempty"`
+	Timeout                        string `json:",omitempty"`
 	DeregisterCriticalServiceAfter string
 }
 
+type weights struct {
+	Passing int
+	Warning int
+}
+
 type register struct {
-	ID      string
-	Name    string
-	Tags    []string
-	Address string
-	Port    int
-	Check   check
+	ID                string
+	Name              string
+	Tags              []string
+	Address           string
+	Port              int
+	Meta              map[string]string `json:",omitempty"`
+	Weights           *weights          `json:",omitempty"`
+	EnableTagOverride bool              `json:",omitempty"`
+	Check             check
+	Checks            []check `json:",omitempty"`
 }
@@ -32,9 +32,12 @@ var _ = Describe("Consul", func() {
 			},
 		}
 		cfg = &Config{
-			CheckInterval:   time.Minute,
-			CheckTimeout:    10 * time.Second,
-			DeregisterAfter: 30 * time.Minute,
+			CheckInterval:     time.Minute,
+			CheckTimeout:      10 * time.Second,
+			DeregisterAfter:   30 * time.Minute,
+			CheckMode:         "http",
+			CheckTtl:          30 * time.Second,
+			HeartbeatInterval: 10 * time.Second,
 		}
 
 		csl = cfg.New(client)
@@ -45,10 +48,13 @@ var _ = Describe("Consul", func() {
 		When("all goes well", func() {
 			It("creates one with client and cfg durations", func() {
 				Expect(csl).To(Equal(&Consul{
-					Client:          client,
-					CheckInterval:   time.Minute,
-					CheckTimeout:    10 * time.Second,
-					DeregisterAfter: 30 * time.Minute,
+					Client:            client,
+					CheckInterval:     time.Minute,
+					CheckTimeout:      10 * time.Second,
+					DeregisterAfter:   30 * time.Minute,
+					CheckMode:         "http",
+					CheckTtl:          30 * time.Second,
+					HeartbeatInterval: 10 * time.Second,
 				}))
 			})
 		})
@@ -95,6 +101,7 @@ var _ = Describe("Consul", func() {
 						Address: "1.2.3.4",
 						Port:    8082,
 						Check: check{
+							CheckID:                        "service:foobear-123",
 							Status:                         "passing",
 							HTTP:                           "http://1.2.3.4:8082/monitor",
 							Interval:                       "1m0s",
@@ -106,6 +113,118 @@ var _ = Describe("Consul", func() {
 				})
 			})
 
+			When("datacenter, namespace and partition are set", func() {
+				BeforeEach(func() {
+					csl.Datacenter = "dc2"
+					csl.Namespace = "team-a"
+					csl.Partition = "east"
+				})
+
+				It("adds them as query parameters", func() {
+					Expect(err).ToNot(HaveOccurred())
+					Expect(client.SendObjectCalls()[0].Path).To(Equal("/v1/agent/service/register?dc=dc2&ns=team-a&partition=east"))
+				})
+			})
+
+			When("service has metadata, weights and additional checks", func() {
+				BeforeEach(func() {
+					svc.Meta = map[string]string{"version": "1.2.3", "run_id": "abc"}
+					svc.Weights = entity.Weights{Passing: 10, Warning: 1}
+					svc.EnableTagOverride = true
+					svc.Checks = []entity.Check{
+						{Kind: "http", Target: "http://%s:%d/ready", Interval: 15 * time.Second, Timeout: 2 * time.Second},
+						{Kind: "tcp", Target: "%s:%d", Interval: 30 * time.Second},
+						{Kind: "grpc", Target: "%s:%d/grpc.health.v1.Health", Interval: time.Minute},
+						{Kind: "ttl", Interval: 2 * time.Minute},
+					}
+				})
+
+				It("registers them along with the primary check", func() {
+					Expect(err).ToNot(HaveOccurred())
+
+					reg, ok := client.SendObjectCalls()[0].Snd.(register)
+					Expect(ok).To(BeTrue())
+
+					Expect(reg.Meta).To(Equal(map[string]string{"version": "1.2.3", "run_id": "abc"}))
+					Expect(reg.Weights).To(Equal(&weights{Passing: 10, Warning: 1}))
+					Expect(reg.EnableTagOverride).To(BeTrue())
+					Expect(reg.Check.HTTP).To(Equal("http://1.2.3.4:8082/monitor"))
+					Expect(reg.Check.CheckID).To(Equal("service:foobear-123"))
+					Expect(reg.Checks).To(Equal([]check{
+						{
+							CheckID:                        "service:foobear-123:2",
+							Status:                         "passing",
+							HTTP:                           "http://1.2.3.4:8082/ready",
+							Interval:                       "15s",
+							Timeout:                        "2s",
+							DeregisterCriticalServiceAfter: "30m0s",
+						},
+						{
+							CheckID:                        "service:foobear-123:3",
+							Status:                         "passing",
+							TCP:                            "1.2.3.4:8082",
+							Interval:                       "30s",
+							DeregisterCriticalServiceAfter: "30m0s",
+						},
+						{
+							CheckID:                        "service:foobear-123:4",
+							Status:                         "passing",
+							GRPC:                           "1.2.3.4:8082/grpc.health.v1.Health",
+							Interval:                       "1m0s",
+							DeregisterCriticalServiceAfter: "30m0s",
+						},
+						{
+							CheckID:                        "service:foobear-123:5",
+							Status:                         "passing",
+							TTL:                            "2m0s",
+							DeregisterCriticalServiceAfter: "30m0s",
+						},
+					}))
+				})
+			})
+
+			When("a check targets another address", func() {
+				BeforeEach(func() {
+					svc.Checks = []entity.Check{
+						{Kind: "tcp", Target: "db:5432", Interval: 30 * time.Second},
+					}
+				})
+
+				It("uses the target as is", func() {
+					Expect(err).ToNot(HaveOccurred())
+
+					reg, ok := client.SendObjectCalls()[0].Snd.(register)
+					Expect(ok).To(BeTrue())
+					Expect(reg.Checks[0].TCP).To(Equal("db:5432"))
+				})
+			})
+
+			When("in ttl mode", func() {
+				BeforeEach(func() {
+					csl.CheckMode = "ttl"
+				})
+
+				It("registers a ttl check", func() {
+					Expect(err).ToNot(HaveOccurred())
+
+					soc := client.SendObjectCalls()
+					Expect(soc).To(HaveLen(1))
+					Expect(soc[0].Snd).To(Equal(register{
+						ID:      "foobear-123",
+						Name:    "foobear",
+						Tags:    []string{"one", "two"},
+						Address: "1.2.3.4",
+						Port:    8082,
+						Check: check{
+							CheckID:                        "service:foobear-123",
+							Status:                         "passing",
+							TTL:                            "30s",
+							DeregisterCriticalServiceAfter: "30m0s",
+						},
+					}))
+				})
+			})
+
 			When("client has trouble", func() {
 				BeforeEach(func() {
 					client.SendObjectFunc = func(ctx context.Context, method string, path string, snd any, rcv any) error {
@@ -120,6 +239,200 @@ var _ = Describe("Consul", func() {
 
 		})
 
+		Describe("verifying registration", func() {
+			var (
+				found map[string]any
+				ok    bool
+			)
+
+			BeforeEach(func() {
+				found = map[string]any{"foobear-123": map[string]any{"ID": "foobear-123"}}
+				client.SendObjectFunc = func(ctx context.Context, method string, path string, snd any, rcv any) error {
+					rm, _ := rcv.(*map[string]any)
+					*rm = found
+					return nil
+				}
+			})
+
+			JustBeforeEach(func() {
+				ok, err = csl.Registered(ctx, svc)
+			})
+
+			When("service is found", func() {
+				It("queries the agent filtered by id", func() {
+					Expect(err).ToNot(HaveOccurred())
+					Expect(ok).To(BeTrue())
+
+					soc := client.SendObjectCalls()
+					Expect(soc).To(HaveLen(1))
+					Expect(soc[0].Method).To(Equal("GET"))
+					Expect(soc[0].Path).To(Equal("/v1/agent/services?filter=ID+%3D%3D+%22foobear-123%22"))
+				})
+			})
+
+			When("service is not found", func() {
+				BeforeEach(func() {
+					found = map[string]any{}
+				})
+
+				It("is not ok", func() {
+					Expect(err).ToNot(HaveOccurred())
+					Expect(ok).To(BeFalse())
+				})
+			})
+
+			When("client has trouble", func() {
+				BeforeEach(func() {
+					client.SendObjectFunc = func(ctx context.Context, method string, path string, snd any, rcv any) error {
+						return fmt.Errorf("oops")
+					}
+				})
+
+				It("relays the error", func() {
+					Expect(err).To(MatchError("oops"))
+				})
+			})
+		})
+
+		Describe("getting heartbeat period", func() {
+
+			When("in http mode", func() {
+				It("is zero", func() {
+					Expect(csl.HeartbeatPeriod(svc)).To(BeZero())
+				})
+			})
+
+			When("service has an additional ttl check", func() {
+				BeforeEach(func() {
+					svc.Checks = []entity.Check{{Kind: "ttl", Interval: time.Minute}}
+				})
+
+				It("is the heartbeat interval", func() {
+					Expect(csl.HeartbeatPeriod(svc)).To(Equal(10 * time.Second))
+				})
+			})
+
+			When("in ttl mode", func() {
+				BeforeEach(func() {
+					csl.CheckMode = "ttl"
+				})
+
+				It("is the heartbeat interval", func() {
+					Expect(csl.HeartbeatPeriod(svc)).To(Equal(10 * time.Second))
+				})
+			})
+		})
+
+		Describe("heartbeating", func() {
+			var (
+				status string
+			)
+
+			BeforeEach(func() {
+				csl.CheckMode = "ttl"
+				status = "warning"
+			})
+
+			JustBeforeEach(func() {
+				err = csl.Heartbeat(ctx, svc, status, "1 of 2 collectors failed")
+			})
+
+			When("all goes well", func() {
+				It("updates the check with note", func() {
+					Expect(err).ToNot(HaveOccurred())
+
+					soc := client.SendObjectCalls()
+					Expect(soc).To(HaveLen(1))
+					Expect(soc[0].Method).To(Equal("PUT"))
+					Expect(soc[0].Path).To(Equal("/v1/agent/check/warn/service:foobear-123?note=1+of+2+collectors+failed"))
+					Expect(soc[0].Snd).To(BeNil())
+				})
+			})
+
+			When("there is an additional ttl check", func() {
+				BeforeEach(func() {
+					svc.Checks = []entity.Check{
+						{Kind: "tcp", Target: "%s:%d", Interval: time.Minute},
+						{Kind: "ttl", Interval: time.Minute},
+					}
+				})
+
+				It("updates each ttl check", func() {
+					Expect(err).ToNot(HaveOccurred())
+
+					soc := client.SendObjectCalls()
+					Expect(soc).To(HaveLen(2))
+					Expect(soc[0].Path).To(Equal("/v1/agent/check/warn/service:foobear-123?note=1+of+2+collectors+failed"))
+					Expect(soc[1].Path).To(Equal("/v1/agent/check/warn/service:foobear-123:3?note=1+of+2+collectors+failed"))
+				})
+			})
+
+			When("status is unknown", func() {
+				BeforeEach(func() {
+					status = "bargle"
+				})
+
+				It("errors without calling the client", func() {
+					Expect(err).To(MatchError("unknown check status: bargle"))
+					Expect(client.SendObjectCalls()).To(BeEmpty())
+				})
+			})
+		})
+
+		Describe("updating checks with a namespace", func() {
+
+			BeforeEach(func() {
+				csl.CheckMode = "ttl"
+				csl.Namespace = "team-a"
+			})
+
+			JustBeforeEach(func() {
+				err = csl.Heartbeat(ctx, svc, "passing", "ok")
+			})
+
+			It("appends to the existing query", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(client.SendObjectCalls()[0].Path).To(Equal("/v1/agent/check/pass/service:foobear-123?note=ok&ns=team-a"))
+			})
+		})
+
+		Describe("toggling maintenance", func() {
+			var (
+				enable bool
+			)
+
+			JustBeforeEach(func() {
+				err = csl.Maintenance(ctx, svc, enable, "deploying now")
+			})
+
+			When("enabling", func() {
+				BeforeEach(func() {
+					enable = true
+				})
+
+				It("puts the service in maintenance with reason", func() {
+					Expect(err).ToNot(HaveOccurred())
+
+					soc := client.SendObjectCalls()
+					Expect(soc).To(HaveLen(1))
+					Expect(soc[0].Method).To(Equal("PUT"))
+					Expect(soc[0].Path).To(Equal("/v1/agent/service/maintenance/foobear-123?enable=true&reason=deploying+now"))
+					Expect(soc[0].Snd).To(BeNil())
+				})
+			})
+
+			When("disabling", func() {
+				BeforeEach(func() {
+					enable = false
+				})
+
+				It("takes the service out of maintenance", func() {
+					Expect(err).ToNot(HaveOccurred())
+					Expect(client.SendObjectCalls()[0].Path).To(HavePrefix("/v1/agent/service/maintenance/foobear-123?enable=false"))
+				})
+			})
+		})
+
 		Describe("unregistering", func() {
 
 			JustBeforeEach(func() {
@@ -0,0 +1,105 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"stator/roster/entity"
+)
+
+const (
+	healthPath string = "/v1/health/service/%s?%s"
+)
+
+// Indexer specifies an http client relaying Consul's blocking query index.
+type Indexer interface {
+	GetIndexed(ctx context.Context, path string, rcv any) (index uint64, err error)
+}
+
+// DiscoveryConfig is Consul discovery configuration.
+type DiscoveryConfig struct {
+	Wait time.Duration `json:"wait" desc:"blocking query max wait" default:"5m"`
+}
+
+// Discovery lists healthy instances of a service from Consul.
+type Discovery struct {
+	Client Indexer
+	Wait   time.Duration
+}
+
+// New creates a Discovery from DiscoveryConfig.
+func (cfg *DiscoveryConfig) New(client Indexer) *Discovery {
+
+	return &Discovery{
+		Client: client,
+		Wait:   cfg.Wait,
+	}
+}
+
+// Discover lists passing instances of the named service, filtered by tag when not blank.
+//
+// An index of zero returns straight away, otherwise the query blocks until
+// Consul's index moves past it or Wait elapses.
+func (dsc *Discovery) Discover(ctx context.Context, name, tag string, index uint64) (svcs []entity.Service, next uint64, err error) {
+
+	query := url.Values{}
+	query.Set("passing", "true")
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+	if index != 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", dsc.Wait.String())
+	}
+
+	entries := []healthEntry{}
+
+	next, err = dsc.Client.GetIndexed(ctx, fmt.Sprintf(healthPath, url.PathEscape(name), query.Encode()), &entries)
+	if err != nil {
+		return
+	}
+
+	svcs = make([]entity.Service, len(entries))
+	for i, entry := range entries {
+		svcs[i] = entry.service()
+	}
+
+	return
+}
+
+// unexported
+
+type healthEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		ID      string
+		Service string
+		Tags    []string
+		Address string
+		Port    int
+	}
+}
+
+func (entry healthEntry) service() entity.Service {
+
+	// undoing NameId when registered by roster, otherwise Id is as found
+
+	address := entry.Service.Address
+	if address == "" {
+		address = entry.Node.Address
+	}
+
+	return entity.Service{
+		Id:        strings.TrimPrefix(entry.Service.ID, entry.Service.Service+"-"),
+		Name:      entry.Service.Service,
+		Tags:      entry.Service.Tags,
+		IpAddress: address,
+		Port:      entry.Service.Port,
+	}
+}
@@ -0,0 +1,173 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"stator/roster/entity"
+)
+
+var _ = Describe("Discovery", func() {
+	var (
+		client *IndexerMock
+		dsc    *Discovery
+	)
+
+	BeforeEach(func() {
+		client = &IndexerMock{
+			GetIndexedFunc: func(ctx context.Context, path string, rcv any) (uint64, error) {
+				return 44, json.Unmarshal([]byte(healthy), rcv)
+			},
+		}
+
+		dsc = (&DiscoveryConfig{Wait: 5 * time.Minute}).New(client)
+	})
+
+	Describe("discovering healthy instances", func() {
+		var (
+			ctx   context.Context
+			tag   string
+			index uint64
+			svcs  []entity.Service
+			next  uint64
+			err   error
+		)
+
+		BeforeEach(func() {
+			ctx = context.Background()
+			tag = "metrics"
+			index = 0
+		})
+
+		JustBeforeEach(func() {
+			svcs, next, err = dsc.Discover(ctx, "stator", tag, index)
+		})
+
+		When("all goes well", func() {
+			It("queries passing instances with tag and maps them to services", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(next).To(Equal(uint64(44)))
+
+				gic := client.GetIndexedCalls()
+				Expect(gic).To(HaveLen(1))
+				Expect(gic[0].Ctx).To(Equal(ctx))
+				Expect(gic[0].Path).To(Equal("/v1/health/service/stator?passing=true&tag=metrics"))
+
+				Expect(svcs).To(Equal([]entity.Service{
+					{
+						Id:        "123654",
+						Name:      "stator",
+						Tags:      []string{"dev", "metrics"},
+						IpAddress: "10.0.0.7",
+						Port:      8087,
+					},
+					{
+						Id:        "other",
+						Name:      "stator",
+						Tags:      []string{"metrics"},
+						IpAddress: "10.0.0.8",
+						Port:      8088,
+					},
+				}))
+			})
+		})
+
+		When("blocking on an index without tag", func() {
+			BeforeEach(func() {
+				tag = ""
+				index = 42
+			})
+
+			It("adds index and wait to the query", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(client.GetIndexedCalls()[0].Path).To(Equal("/v1/health/service/stator?index=42&passing=true&wait=5m0s"))
+			})
+		})
+
+		When("client has trouble", func() {
+			BeforeEach(func() {
+				client.GetIndexedFunc = func(ctx context.Context, path string, rcv any) (uint64, error) {
+					return 0, fmt.Errorf("oops")
+				}
+			})
+
+			It("relays the error", func() {
+				Expect(err).To(MatchError("oops"))
+			})
+		})
+	})
+})
+
+var _ = Describe("Indexed", func() {
+	var (
+		server *httptest.Server
+		status int
+		got    *http.Request
+		idx    *Indexed
+		rcv    []map[string]any
+		index  uint64
+		err    error
+	)
+
+	BeforeEach(func() {
+		status = http.StatusOK
+		server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			got = request
+			writer.Header().Set("X-Consul-Index", "44")
+			writer.WriteHeader(status)
+			fmt.Fprint(writer, healthy)
+		}))
+
+		cfg := &Config{Token: "s3cr3t", Datacenter: "dc2"}
+		idx = cfg.NewIndexed(server.URL, cfg.Tripper(&LoggerMock{}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	JustBeforeEach(func() {
+		rcv = nil
+		index, err = idx.GetIndexed(context.Background(), "/v1/health/service/stator", &rcv)
+	})
+
+	When("all goes well", func() {
+		It("sends token and scope, decodes the body and relays the index", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(got.Header.Get("X-Consul-Token")).To(Equal("s3cr3t"))
+			Expect(got.URL.String()).To(Equal("/v1/health/service/stator?dc=dc2"))
+			Expect(index).To(Equal(uint64(44)))
+			Expect(rcv).To(HaveLen(2))
+		})
+	})
+
+	When("consul is unhappy", func() {
+		BeforeEach(func() {
+			status = http.StatusForbidden
+		})
+
+		It("errors", func() {
+			Expect(err).To(MatchError("unexpected status 403 from /v1/health/service/stator?dc=dc2"))
+		})
+	})
+})
+
+var healthy = `[
+  {
+    "Node": {"Node": "alpha", "Address": "10.0.0.9"},
+    "Service": {"ID": "stator-123654", "Service": "stator", "Tags": ["dev", "metrics"], "Address": "10.0.0.7", "Port": 8087},
+    "Checks": []
+  },
+  {
+    "Node": {"Node": "beta", "Address": "10.0.0.8"},
+    "Service": {"ID": "other", "Service": "stator", "Tags": ["metrics"], "Address": "", "Port": 8088},
+    "Checks": []
+  }
+]`
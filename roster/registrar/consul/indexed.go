@@ -0,0 +1,58 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Indexed is an http client for Consul reads that relays the X-Consul-Index header.
+//
+// Client is expected to carry a TokenRt, see Config.NewIndexed, and is left without
+// a timeout so that blocking queries are bounded by their wait and ctx alone.
+type Indexed struct {
+	BaseUri    string
+	Client     *http.Client
+	Datacenter string
+	Namespace  string
+	Partition  string
+}
+
+// GetIndexed gets path and decodes the json response into rcv.
+func (idx *Indexed) GetIndexed(ctx context.Context, path string, rcv any) (index uint64, err error) {
+
+	path = scoped(path, idx.Datacenter, idx.Namespace, idx.Partition)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, idx.BaseUri+path, nil)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to create request for %s", path)
+		return
+	}
+
+	response, err := idx.Client.Do(request)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to get %s", path)
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		err = errors.Errorf("unexpected status %d from %s", response.StatusCode, path)
+		return
+	}
+
+	err = json.NewDecoder(response.Body).Decode(rcv)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to decode response from %s", path)
+		return
+	}
+
+	index, err = strconv.ParseUint(response.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to parse index from %s", path)
+	}
+	return
+}
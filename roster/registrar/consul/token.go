@@ -0,0 +1,116 @@
+package consul
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Logger specifies a logger.
+type Logger interface {
+	Error(ctx context.Context, msg string, err error, kv ...any)
+}
+
+// Token is an acl token, given directly or read from a file.
+//
+// The file is re-read when its modification time changes, so a rotated token
+// is picked up without restarting.
+type Token struct {
+	Value string
+	File  string
+
+	mu      sync.Mutex
+	modTime time.Time
+	read    bool
+	cached  string
+}
+
+// Get returns the current token, blank when none is configured.
+//
+// When the file cannot be re-read, the last token read is returned along with the
+// error, with stale true, so that a hiccup in rotation need not fail requests.
+func (tkn *Token) Get() (token string, stale bool, err error) {
+
+	if tkn == nil {
+		return
+	}
+	if tkn.File == "" {
+		token = tkn.Value
+		return
+	}
+
+	tkn.mu.Lock()
+	defer tkn.mu.Unlock()
+
+	token = tkn.cached
+	stale = tkn.read
+
+	info, err := os.Stat(tkn.File)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to stat token file")
+		return
+	}
+
+	if !info.ModTime().Equal(tkn.modTime) {
+		var data []byte
+		data, err = os.ReadFile(tkn.File)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to read token file")
+			return
+		}
+
+		tkn.cached = strings.TrimSpace(string(data))
+		tkn.modTime = info.ModTime()
+		tkn.read = true
+	}
+
+	token = tkn.cached
+	stale = false
+	return
+}
+
+// TokenRt is a round tripper setting the X-Consul-Token header, suitable for use with giant.
+//
+// A stale token is logged and used, while failing to get one at all fails the request.
+type TokenRt struct {
+	Token  *Token
+	Logger Logger
+	next   http.RoundTripper
+}
+
+// Wrap sets the next round tripper.
+func (rt *TokenRt) Wrap(next http.RoundTripper) {
+
+	rt.next = next
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *TokenRt) RoundTrip(request *http.Request) (response *http.Response, err error) {
+
+	token, stale, err := rt.Token.Get()
+	if err != nil && !stale {
+		return
+	}
+	if err != nil {
+		rt.Logger.Error(request.Context(), "using stale consul token", err)
+		err = nil
+	}
+
+	if token != "" {
+		request = request.Clone(request.Context())
+		request.Header.Set("X-Consul-Token", token)
+	}
+
+	next := rt.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	response, err = next.RoundTrip(request)
+	return
+}
@@ -0,0 +1,154 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Token", func() {
+	var (
+		cfg *Config
+		lgr *LoggerMock
+		rt  *TokenRt
+	)
+
+	BeforeEach(func() {
+		cfg = &Config{Token: "s3cr3t"}
+		lgr = &LoggerMock{
+			ErrorFunc: func(ctx context.Context, msg string, err error, kv ...any) {},
+		}
+		rt = cfg.Tripper(lgr)
+	})
+
+	Describe("getting a token", func() {
+
+		When("given directly", func() {
+			It("returns it", func() {
+				Expect(rt.Token.Get()).To(Equal("s3cr3t"))
+			})
+		})
+
+		When("given in a file that is rotated", func() {
+			var (
+				path string
+			)
+
+			BeforeEach(func() {
+				path = filepath.Join(GinkgoT().TempDir(), "token")
+				Expect(os.WriteFile(path, []byte("first\n"), 0o600)).To(Succeed())
+
+				cfg.TokenFile = path
+				rt = cfg.Tripper(lgr)
+			})
+
+			It("prefers the file and re-reads it on change", func() {
+				Expect(rt.Token.Get()).To(Equal("first"))
+
+				Expect(os.WriteFile(path, []byte("second\n"), 0o600)).To(Succeed())
+				later := time.Now().Add(time.Second)
+				Expect(os.Chtimes(path, later, later)).To(Succeed())
+
+				Expect(rt.Token.Get()).To(Equal("second"))
+			})
+
+			It("keeps the last token read when the file goes missing", func() {
+				Expect(rt.Token.Get()).To(Equal("first"))
+
+				Expect(os.Remove(path)).To(Succeed())
+
+				token, stale, err := rt.Token.Get()
+				Expect(err).To(MatchError(ContainSubstring("failed to stat token file")))
+				Expect(stale).To(BeTrue())
+				Expect(token).To(Equal("first"))
+			})
+		})
+
+		When("file is missing", func() {
+			BeforeEach(func() {
+				cfg.TokenFile = "/does/not/exist"
+				rt = cfg.Tripper(lgr)
+			})
+
+			It("errors", func() {
+				_, stale, err := rt.Token.Get()
+				Expect(err).To(MatchError(ContainSubstring("failed to stat token file")))
+				Expect(stale).To(BeFalse())
+			})
+		})
+	})
+
+	Describe("round tripping", func() {
+		var (
+			header http.Header
+			err    error
+		)
+
+		JustBeforeEach(func() {
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				header = request.Header
+			}))
+			DeferCleanup(server.Close)
+
+			rt.Wrap(http.DefaultTransport)
+
+			var response *http.Response
+			response, err = (&http.Client{Transport: rt}).Get(server.URL + "/v1/agent/services")
+			if err == nil {
+				response.Body.Close()
+			}
+		})
+
+		It("sets the token header", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(header.Get("X-Consul-Token")).To(Equal("s3cr3t"))
+		})
+
+		When("the token file has gone missing since last read", func() {
+			BeforeEach(func() {
+				path := filepath.Join(GinkgoT().TempDir(), "token")
+				Expect(os.WriteFile(path, []byte("first\n"), 0o600)).To(Succeed())
+
+				cfg.TokenFile = path
+				rt = cfg.Tripper(lgr)
+				Expect(rt.Token.Get()).To(Equal("first"))
+
+				Expect(os.Remove(path)).To(Succeed())
+			})
+
+			It("logs and carries on with the last token", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(header.Get("X-Consul-Token")).To(Equal("first"))
+				Expect(lgr.ErrorCalls()).To(HaveLen(1))
+				Expect(lgr.ErrorCalls()[0].Msg).To(Equal("using stale consul token"))
+			})
+		})
+
+		When("the token file was never read", func() {
+			BeforeEach(func() {
+				cfg.TokenFile = "/does/not/exist"
+				rt = cfg.Tripper(lgr)
+			})
+
+			It("fails the request", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to stat token file")))
+			})
+		})
+	})
+
+	Describe("logging config", func() {
+		It("redacts the token", func() {
+			data, err := json.Marshal(cfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(ContainSubstring(`"token":"--redacted--"`))
+			Expect(string(data)).ToNot(ContainSubstring("s3cr3t"))
+		})
+	})
+})
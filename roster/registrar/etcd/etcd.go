@@ -0,0 +1,238 @@
+// Package etcd provides for registration with etcd via its v3 json gateway.
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"stator/roster/entity"
+)
+
+//go:generate moq -out mock_test.go . Client
+
+const (
+	grantPath  string = "/v3/lease/grant"
+	alivePath  string = "/v3/lease/keepalive"
+	revokePath string = "/v3/lease/revoke"
+	putPath    string = "/v3/kv/put"
+	rangePath  string = "/v3/kv/range"
+	deletePath string = "/v3/kv/deleterange"
+)
+
+// Client specifies an http client.
+type Client interface {
+	SendObject(ctx context.Context, method, path string, snd, rcv any) (err error)
+}
+
+// Config is Etcd configuration.
+type Config struct {
+	Prefix    string        `json:"prefix" desc:"key prefix under which services are written" default:"/services/"`
+	LeaseTtl  time.Duration `json:"lease_ttl" desc:"lease time to live" default:"30s"`
+	KeepAlive time.Duration `json:"keepalive_interval" desc:"lease keepalive period" default:"10s"`
+}
+
+// Etcd is an etcd client.
+//
+// Services are written as json to Prefix + name/id, bound to a lease which is kept alive
+// via Heartbeat and revoked on Unregister, such that etcd forgets about us should we stop abruptly.
+type Etcd struct {
+	Client    Client
+	Prefix    string
+	LeaseTtl  time.Duration
+	KeepAlive time.Duration
+
+	mu     sync.Mutex
+	leases map[string]int64
+}
+
+// New creates an Etcd from Config.
+func (cfg *Config) New(client Client) *Etcd {
+
+	return &Etcd{
+		Client:    client,
+		Prefix:    cfg.Prefix,
+		LeaseTtl:  cfg.LeaseTtl,
+		KeepAlive: cfg.KeepAlive,
+		leases:    map[string]int64{},
+	}
+}
+
+// Register writes the service under its lease, granting a new lease when needed.
+func (etc *Etcd) Register(ctx context.Context, svc entity.Service) (err error) {
+
+	lease, err := etc.lease(ctx, svc)
+	if err != nil {
+		return
+	}
+
+	value, err := json.Marshal(svc)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to marshal service")
+		return
+	}
+
+	rq := putRequest{
+		Key:   []byte(etc.key(svc)),
+		Value: value,
+		Lease: lease,
+	}
+
+	err = etc.Client.SendObject(ctx, "POST", putPath, rq, nil)
+	if err != nil {
+		// lease may be gone, or may yet be live and so left to expire with nothing to show,
+		// revoking in case and granting anew next time, relaying the put error regardless
+		etc.forget(svc)
+		_ = etc.Client.SendObject(ctx, "POST", revokePath, leaseRequest{ID: lease}, nil)
+	}
+	return
+}
+
+// Unregister revokes the service's lease, deleting its key.
+func (etc *Etcd) Unregister(ctx context.Context, svc entity.Service) (err error) {
+
+	lease, ok := etc.known(svc)
+	etc.forget(svc)
+
+	if !ok {
+		err = etc.Client.SendObject(ctx, "POST", deletePath, keyRequest{Key: []byte(etc.key(svc))}, nil)
+		return
+	}
+
+	err = etc.Client.SendObject(ctx, "POST", revokePath, leaseRequest{ID: lease}, nil)
+	return
+}
+
+// Registered checks that the service's key is present.
+func (etc *Etcd) Registered(ctx context.Context, svc entity.Service) (ok bool, err error) {
+
+	rs := rangeResponse{}
+
+	err = etc.Client.SendObject(ctx, "POST", rangePath, keyRequest{Key: []byte(etc.key(svc))}, &rs)
+	if err != nil {
+		return
+	}
+
+	ok = rs.Count > 0
+	return
+}
+
+// HeartbeatPeriod returns the keepalive period.
+func (etc *Etcd) HeartbeatPeriod(svc entity.Service) time.Duration {
+
+	return etc.KeepAlive
+}
+
+// Heartbeat keeps the service's lease alive, re-registering if it has expired.
+//
+// Etcd has no notion of health, so status and note are ignored.
+func (etc *Etcd) Heartbeat(ctx context.Context, svc entity.Service, status, note string) (err error) {
+
+	lease, ok := etc.known(svc)
+	if ok {
+		ok, err = etc.keepAlive(ctx, lease)
+		if err != nil || ok {
+			return
+		}
+		etc.forget(svc)
+	}
+
+	err = etc.Register(ctx, svc)
+	return
+}
+
+// unexported
+
+type leaseRequest struct {
+	TTL int64 `json:"TTL,omitempty,string"`
+	ID  int64 `json:"ID,string"`
+}
+
+type leaseResponse struct {
+	ID  int64 `json:"ID,string"`
+	TTL int64 `json:"TTL,string"`
+}
+
+type aliveResponse struct {
+	Result leaseResponse `json:"result"`
+}
+
+type putRequest struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+	Lease int64  `json:"lease,string"`
+}
+
+type keyRequest struct {
+	Key []byte `json:"key"`
+}
+
+type rangeResponse struct {
+	Count int64 `json:"count,string"`
+}
+
+func (etc *Etcd) key(svc entity.Service) string {
+
+	return fmt.Sprintf("%s%s/%s", etc.Prefix, svc.Name, svc.Id)
+}
+
+func (etc *Etcd) lease(ctx context.Context, svc entity.Service) (lease int64, err error) {
+
+	lease, ok := etc.known(svc)
+	if ok {
+		return
+	}
+
+	rs := leaseResponse{}
+
+	err = etc.Client.SendObject(ctx, "POST", grantPath, leaseRequest{TTL: int64(etc.LeaseTtl.Seconds())}, &rs)
+	if err != nil {
+		return
+	}
+	lease = rs.ID
+
+	etc.mu.Lock()
+	if etc.leases == nil {
+		etc.leases = map[string]int64{}
+	}
+	etc.leases[svc.NameId()] = lease
+	etc.mu.Unlock()
+
+	return
+}
+
+func (etc *Etcd) known(svc entity.Service) (lease int64, ok bool) {
+
+	etc.mu.Lock()
+	defer etc.mu.Unlock()
+
+	lease, ok = etc.leases[svc.NameId()]
+	return
+}
+
+func (etc *Etcd) forget(svc entity.Service) {
+
+	etc.mu.Lock()
+	defer etc.mu.Unlock()
+
+	delete(etc.leases, svc.NameId())
+}
+
+func (etc *Etcd) keepAlive(ctx context.Context, lease int64) (ok bool, err error) {
+
+	// expired leases come back with no ttl
+
+	rs := aliveResponse{}
+
+	err = etc.Client.SendObject(ctx, "POST", alivePath, leaseRequest{ID: lease}, &rs)
+	if err != nil {
+		return
+	}
+
+	ok = rs.Result.TTL > 0
+	return
+}
@@ -0,0 +1,345 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"stator/roster/entity"
+)
+
+func TestEtcd(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Etcd Suite")
+}
+
+var _ = Describe("Etcd", func() {
+	var (
+		cfg    *Config
+		fake   *fakeEtcd
+		client *ClientMock
+		etc    *Etcd
+	)
+
+	BeforeEach(func() {
+		fake = &fakeEtcd{
+			leases: map[int64]bool{},
+			kvs:    map[string]int64{},
+			next:   7587861251231234,
+		}
+		client = &ClientMock{
+			SendObjectFunc: fake.SendObject,
+		}
+		cfg = &Config{
+			Prefix:    "/services/",
+			LeaseTtl:  30 * time.Second,
+			KeepAlive: 10 * time.Second,
+		}
+
+		etc = cfg.New(client)
+	})
+
+	Describe("creating a registrar", func() {
+		It("creates one with client and cfg", func() {
+			Expect(etc).To(Equal(&Etcd{
+				Client:    client,
+				Prefix:    "/services/",
+				LeaseTtl:  30 * time.Second,
+				KeepAlive: 10 * time.Second,
+				leases:    map[string]int64{},
+			}))
+		})
+	})
+
+	Describe("interacting with etcd", func() {
+		var (
+			ctx context.Context
+			svc entity.Service
+			err error
+		)
+
+		BeforeEach(func() {
+			ctx = context.Background()
+			svc = entity.Service{
+				Id:          "123",
+				Name:        "foobear",
+				Tags:        []string{"one", "two"},
+				IpAddress:   "1.2.3.4",
+				Port:        8082,
+				MonitorSpec: "http://%s:%d/monitor",
+			}
+		})
+
+		Describe("registering", func() {
+
+			JustBeforeEach(func() {
+				err = etc.Register(ctx, svc)
+			})
+
+			When("all goes well", func() {
+				It("grants a lease and puts the service json under it", func() {
+					Expect(err).ToNot(HaveOccurred())
+
+					soc := client.SendObjectCalls()
+					Expect(soc).To(HaveLen(2))
+					Expect(soc[0].Method).To(Equal("POST"))
+					Expect(soc[0].Path).To(Equal("/v3/lease/grant"))
+					Expect(fake.raw[0]).To(MatchJSON(`{"TTL":"30","ID":"0"}`))
+
+					Expect(soc[1].Path).To(Equal("/v3/kv/put"))
+					Expect(fake.kvs).To(HaveKeyWithValue("/services/foobear/123", int64(7587861251231234)))
+
+					stored := entity.Service{}
+					Expect(json.Unmarshal(fake.values["/services/foobear/123"], &stored)).To(Succeed())
+					Expect(stored).To(Equal(svc))
+				})
+			})
+
+			When("already registered", func() {
+				BeforeEach(func() {
+					Expect(etc.Register(ctx, svc)).To(Succeed())
+				})
+
+				It("re-puts under the same lease", func() {
+					Expect(err).ToNot(HaveOccurred())
+
+					soc := client.SendObjectCalls()
+					Expect(soc).To(HaveLen(3))
+					Expect(soc[2].Path).To(Equal("/v3/kv/put"))
+				})
+			})
+
+			When("lease has gone missing", func() {
+				BeforeEach(func() {
+					Expect(etc.Register(ctx, svc)).To(Succeed())
+					fake.leases = map[int64]bool{}
+					Expect(etc.Register(ctx, svc)).ToNot(Succeed())
+				})
+
+				It("grants a new one on next attempt", func() {
+					Expect(err).ToNot(HaveOccurred())
+					Expect(fake.kvs).To(HaveKeyWithValue("/services/foobear/123", int64(7587861251231235)))
+				})
+			})
+
+			When("put fails after granting a lease", func() {
+				BeforeEach(func() {
+					client.SendObjectFunc = func(ctx context.Context, method string, path string, snd any, rcv any) error {
+						if path == putPath {
+							return fmt.Errorf("oops")
+						}
+						return fake.SendObject(ctx, method, path, snd, rcv)
+					}
+				})
+
+				It("revokes the lease and relays the error", func() {
+					Expect(err).To(MatchError("oops"))
+
+					soc := client.SendObjectCalls()
+					Expect(soc).To(HaveLen(3))
+					Expect(soc[2].Path).To(Equal("/v3/lease/revoke"))
+					Expect(fake.leases).To(BeEmpty())
+					Expect(etc.leases).To(BeEmpty())
+				})
+			})
+
+			When("client has trouble", func() {
+				BeforeEach(func() {
+					client.SendObjectFunc = func(ctx context.Context, method string, path string, snd any, rcv any) error {
+						return fmt.Errorf("oops")
+					}
+				})
+
+				It("relays the error", func() {
+					Expect(err).To(MatchError("oops"))
+				})
+			})
+		})
+
+		Describe("heartbeating", func() {
+
+			JustBeforeEach(func() {
+				err = etc.Heartbeat(ctx, svc, "passing", "")
+			})
+
+			When("registered", func() {
+				BeforeEach(func() {
+					Expect(etc.Register(ctx, svc)).To(Succeed())
+				})
+
+				It("keeps the lease alive", func() {
+					Expect(err).ToNot(HaveOccurred())
+
+					soc := client.SendObjectCalls()
+					Expect(soc).To(HaveLen(3))
+					Expect(soc[2].Path).To(Equal("/v3/lease/keepalive"))
+					Expect(fake.raw[2]).To(MatchJSON(`{"ID":"7587861251231234"}`))
+				})
+			})
+
+			When("lease has expired", func() {
+				BeforeEach(func() {
+					Expect(etc.Register(ctx, svc)).To(Succeed())
+					fake.leases = map[int64]bool{}
+					fake.kvs = map[string]int64{}
+				})
+
+				It("registers anew", func() {
+					Expect(err).ToNot(HaveOccurred())
+
+					soc := client.SendObjectCalls()
+					Expect(soc).To(HaveLen(5))
+					Expect(soc[3].Path).To(Equal("/v3/lease/grant"))
+					Expect(soc[4].Path).To(Equal("/v3/kv/put"))
+					Expect(fake.kvs).To(HaveKeyWithValue("/services/foobear/123", int64(7587861251231235)))
+				})
+			})
+
+			It("has the keepalive period", func() {
+				Expect(etc.HeartbeatPeriod(svc)).To(Equal(10 * time.Second))
+			})
+		})
+
+		Describe("verifying", func() {
+			var (
+				ok bool
+			)
+
+			JustBeforeEach(func() {
+				ok, err = etc.Registered(ctx, svc)
+			})
+
+			When("registered", func() {
+				BeforeEach(func() {
+					Expect(etc.Register(ctx, svc)).To(Succeed())
+				})
+
+				It("finds the key", func() {
+					Expect(err).ToNot(HaveOccurred())
+					Expect(ok).To(BeTrue())
+				})
+			})
+
+			When("not registered", func() {
+				It("does not find the key", func() {
+					Expect(err).ToNot(HaveOccurred())
+					Expect(ok).To(BeFalse())
+				})
+			})
+		})
+
+		Describe("unregistering", func() {
+
+			JustBeforeEach(func() {
+				err = etc.Unregister(ctx, svc)
+			})
+
+			When("registered", func() {
+				BeforeEach(func() {
+					Expect(etc.Register(ctx, svc)).To(Succeed())
+				})
+
+				It("revokes the lease", func() {
+					Expect(err).ToNot(HaveOccurred())
+
+					soc := client.SendObjectCalls()
+					Expect(soc).To(HaveLen(3))
+					Expect(soc[2].Path).To(Equal("/v3/lease/revoke"))
+					Expect(fake.kvs).To(BeEmpty())
+				})
+			})
+
+			When("lease is unknown", func() {
+				BeforeEach(func() {
+					fake.kvs["/services/foobear/123"] = 99
+				})
+
+				It("deletes the key", func() {
+					Expect(err).ToNot(HaveOccurred())
+
+					soc := client.SendObjectCalls()
+					Expect(soc).To(HaveLen(1))
+					Expect(soc[0].Path).To(Equal("/v3/kv/deleterange"))
+					Expect(fake.kvs).To(BeEmpty())
+				})
+			})
+		})
+	})
+})
+
+// fakeEtcd minimally mimics the etcd v3 json gateway, round-tripping json as would the real client.
+type fakeEtcd struct {
+	leases map[int64]bool
+	kvs    map[string]int64
+	values map[string][]byte
+	next   int64
+	raw    []string
+}
+
+func (fake *fakeEtcd) SendObject(ctx context.Context, method, path string, snd, rcv any) (err error) {
+
+	data, err := json.Marshal(snd)
+	if err != nil {
+		return
+	}
+	fake.raw = append(fake.raw, string(data))
+
+	rq := struct {
+		TTL   int64  `json:"TTL,string"`
+		ID    int64  `json:"ID,string"`
+		Key   []byte `json:"key"`
+		Value []byte `json:"value"`
+		Lease int64  `json:"lease,string"`
+	}{}
+	err = json.Unmarshal(data, &rq)
+	if err != nil {
+		return
+	}
+
+	var rs string
+	switch path {
+	case grantPath:
+		id := fake.next
+		fake.next++
+		fake.leases[id] = true
+		rs = fmt.Sprintf(`{"ID":"%d","TTL":"%d"}`, id, rq.TTL)
+	case alivePath:
+		rs = fmt.Sprintf(`{"result":{"ID":"%d"}}`, rq.ID)
+		if fake.leases[rq.ID] {
+			rs = fmt.Sprintf(`{"result":{"ID":"%d","TTL":"30"}}`, rq.ID)
+		}
+	case putPath:
+		if !fake.leases[rq.Lease] {
+			return fmt.Errorf("etcdserver: requested lease not found")
+		}
+		fake.kvs[string(rq.Key)] = rq.Lease
+		if fake.values == nil {
+			fake.values = map[string][]byte{}
+		}
+		fake.values[string(rq.Key)] = rq.Value
+	case rangePath:
+		rs = `{}`
+		if _, ok := fake.kvs[string(rq.Key)]; ok {
+			rs = `{"count":"1"}`
+		}
+	case revokePath:
+		delete(fake.leases, rq.ID)
+		for key, lease := range fake.kvs {
+			if lease == rq.ID {
+				delete(fake.kvs, key)
+			}
+		}
+	case deletePath:
+		delete(fake.kvs, string(rq.Key))
+	}
+
+	if rcv != nil {
+		err = json.Unmarshal([]byte(rs), rcv)
+	}
+	return
+}
@@ -0,0 +1,304 @@
+// Package eureka provides for registration with Netflix Eureka via its REST api.
+package eureka
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"stator/roster/entity"
+)
+
+//go:generate moq -out mock_test.go . Client
+
+const (
+	appsPath     string = "/apps"
+	appPath      string = "/apps/%s"
+	instancePath string = "/apps/%s/%s"
+	statusPath   string = "/apps/%s/%s/status?%s"
+
+	dataCenterClass string = "com.netflix.appinfo.InstanceInfo$DefaultDataCenterInfo"
+)
+
+// statuses maps roster health to eureka instance status.
+var statuses = map[string]string{
+	entity.Passing:  "UP",
+	entity.Warning:  "UP",
+	entity.Critical: "DOWN",
+}
+
+// Client specifies an http client.
+type Client interface {
+	SendObject(ctx context.Context, method, path string, snd, rcv any) (err error)
+}
+
+// Config is Eureka configuration.
+type Config struct {
+	Renewal    time.Duration `json:"renewal_interval" desc:"lease renewal period" default:"30s"`
+	Duration   time.Duration `json:"lease_duration" desc:"time after which eureka evicts an unrenewed instance" default:"90s"`
+	DataCenter string        `json:"data_center" desc:"data center name" default:"MyOwn"`
+}
+
+// Eureka is a eureka client.
+//
+// Services register under their upper-cased name with an instance id of NameId.
+// Leases are renewed via Heartbeat, re-registering when renewal fails, as when eureka
+// has forgotten the instance, or when health has changed the instance's status.
+// Client's base uri is expected to include eureka's context path, as in http://localhost:8761/eureka.
+type Eureka struct {
+	Client     Client
+	Renewal    time.Duration
+	Duration   time.Duration
+	DataCenter string
+
+	mu     sync.Mutex
+	status map[string]string
+}
+
+// New creates an Eureka from Config.
+func (cfg *Config) New(client Client) *Eureka {
+
+	return &Eureka{
+		Client:     client,
+		Renewal:    cfg.Renewal,
+		Duration:   cfg.Duration,
+		DataCenter: cfg.DataCenter,
+		status:     map[string]string{},
+	}
+}
+
+// Register registers the service as an instance, with status UP unless already known otherwise.
+func (eka *Eureka) Register(ctx context.Context, svc entity.Service) (err error) {
+
+	status, ok := eka.known(svc)
+	if !ok {
+		status = statuses[entity.Passing]
+	}
+
+	err = eka.Client.SendObject(ctx, "POST", fmt.Sprintf(appPath, app(svc)), registration{Instance: eka.instance(svc, status)}, nil)
+	if err != nil {
+		return
+	}
+
+	eka.remember(svc, status)
+	return
+}
+
+// Unregister cancels the service's instance.
+func (eka *Eureka) Unregister(ctx context.Context, svc entity.Service) (err error) {
+
+	eka.forget(svc)
+
+	err = eka.Client.SendObject(ctx, "DELETE", eka.instancePath(svc), nil, nil)
+	return
+}
+
+// Registered checks that eureka knows of the service's instance.
+func (eka *Eureka) Registered(ctx context.Context, svc entity.Service) (ok bool, err error) {
+
+	// eureka answers not found for an unknown instance or app, so looking through all apps,
+	// which is found regardless
+
+	rs := appsResponse{}
+
+	err = eka.Client.SendObject(ctx, "GET", appsPath, nil, &rs)
+	if err != nil {
+		return
+	}
+
+	for _, ap := range rs.Applications.Application {
+		for _, inst := range ap.Instance {
+			if ap.Name == app(svc) && inst.InstanceId == svc.NameId() {
+				ok = true
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// HeartbeatPeriod returns the lease renewal period.
+func (eka *Eureka) HeartbeatPeriod(svc entity.Service) time.Duration {
+
+	return eka.Renewal
+}
+
+// Heartbeat renews the service's lease.
+//
+// Status maps to UP or DOWN, re-registering on change as would a eureka client,
+// and re-registering when renewal fails, relaying the error of the latter.
+// The note is ignored.
+func (eka *Eureka) Heartbeat(ctx context.Context, svc entity.Service, status, note string) (err error) {
+
+	next, ok := statuses[status]
+	if !ok {
+		err = errors.Errorf("unknown status %q", status)
+		return
+	}
+
+	last, ok := eka.known(svc)
+	if ok && last == next {
+		err = eka.Client.SendObject(ctx, "PUT", eka.instancePath(svc)+"?status="+next, nil, nil)
+		if err == nil {
+			return
+		}
+	}
+
+	eka.remember(svc, next)
+	err = eka.Register(ctx, svc)
+	return
+}
+
+// Override sets an overriding status, such as OUT_OF_SERVICE, taking precedence over
+// that which the instance reports until cleared.
+func (eka *Eureka) Override(ctx context.Context, svc entity.Service, status string) (err error) {
+
+	query := url.Values{"value": {status}}
+
+	err = eka.Client.SendObject(ctx, "PUT", fmt.Sprintf(statusPath, app(svc), url.PathEscape(svc.NameId()), query.Encode()), nil, nil)
+	return
+}
+
+// ClearOverride removes an overriding status.
+func (eka *Eureka) ClearOverride(ctx context.Context, svc entity.Service) (err error) {
+
+	status, ok := eka.known(svc)
+	if !ok {
+		status = statuses[entity.Passing]
+	}
+	query := url.Values{"value": {status}}
+
+	err = eka.Client.SendObject(ctx, "DELETE", fmt.Sprintf(statusPath, app(svc), url.PathEscape(svc.NameId()), query.Encode()), nil, nil)
+	return
+}
+
+// unexported
+
+type registration struct {
+	Instance instance `json:"instance"`
+}
+
+type appsResponse struct {
+	Applications struct {
+		Application []struct {
+			Name     string     `json:"name"`
+			Instance []instance `json:"instance"`
+		} `json:"application"`
+	} `json:"applications"`
+}
+
+type instance struct {
+	InstanceId         string            `json:"instanceId"`
+	HostName           string            `json:"hostName"`
+	App                string            `json:"app"`
+	IpAddr             string            `json:"ipAddr"`
+	VipAddress         string            `json:"vipAddress"`
+	Status             string            `json:"status"`
+	Port               port              `json:"port"`
+	SecurePort         port              `json:"securePort"`
+	HomePageUrl        string            `json:"homePageUrl"`
+	StatusPageUrl      string            `json:"statusPageUrl"`
+	HealthCheckUrl     string            `json:"healthCheckUrl"`
+	DataCenterInfo     dataCenterInfo    `json:"dataCenterInfo"`
+	LeaseInfo          leaseInfo         `json:"leaseInfo"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+	LastDirtyTimestamp string            `json:"lastDirtyTimestamp,omitempty"`
+}
+
+type port struct {
+	Port    int    `json:"$"`
+	Enabled string `json:"@enabled"`
+}
+
+type dataCenterInfo struct {
+	Class string `json:"@class"`
+	Name  string `json:"name"`
+}
+
+type leaseInfo struct {
+	RenewalIntervalInSecs int `json:"renewalIntervalInSecs"`
+	DurationInSecs        int `json:"durationInSecs"`
+}
+
+func app(svc entity.Service) string {
+
+	return strings.ToUpper(svc.Name)
+}
+
+func (eka *Eureka) instancePath(svc entity.Service) string {
+
+	return fmt.Sprintf(instancePath, app(svc), url.PathEscape(svc.NameId()))
+}
+
+func (eka *Eureka) instance(svc entity.Service, status string) instance {
+
+	home := fmt.Sprintf("http://%s:%d/", svc.IpAddress, svc.Port)
+	health := fmt.Sprintf(svc.MonitorSpec, svc.IpAddress, svc.Port)
+
+	meta := map[string]string{}
+	for key, val := range svc.Meta {
+		meta[key] = val
+	}
+	if len(svc.Tags) > 0 {
+		meta["tags"] = strings.Join(svc.Tags, ",")
+	}
+	if len(meta) == 0 {
+		meta = nil
+	}
+
+	return instance{
+		InstanceId:     svc.NameId(),
+		HostName:       svc.IpAddress,
+		App:            app(svc),
+		IpAddr:         svc.IpAddress,
+		VipAddress:     svc.Name,
+		Status:         status,
+		Port:           port{Port: svc.Port, Enabled: "true"},
+		SecurePort:     port{Port: 443, Enabled: "false"},
+		HomePageUrl:    home,
+		StatusPageUrl:  health,
+		HealthCheckUrl: health,
+		DataCenterInfo: dataCenterInfo{Class: dataCenterClass, Name: eka.DataCenter},
+		LeaseInfo: leaseInfo{
+			RenewalIntervalInSecs: int(eka.Renewal.Seconds()),
+			DurationInSecs:        int(eka.Duration.Seconds()),
+		},
+		Metadata:           meta,
+		LastDirtyTimestamp: strconv.FormatInt(time.Now().UnixMilli(), 10),
+	}
+}
+
+func (eka *Eureka) known(svc entity.Service) (status string, ok bool) {
+
+	eka.mu.Lock()
+	defer eka.mu.Unlock()
+
+	status, ok = eka.status[svc.NameId()]
+	return
+}
+
+func (eka *Eureka) remember(svc entity.Service, status string) {
+
+	eka.mu.Lock()
+	defer eka.mu.Unlock()
+
+	if eka.status == nil {
+		eka.status = map[string]string{}
+	}
+	eka.status[svc.NameId()] = status
+}
+
+func (eka *Eureka) forget(svc entity.Service) {
+
+	eka.mu.Lock()
+	defer eka.mu.Unlock()
+
+	delete(eka.status, svc.NameId())
+}
@@ -0,0 +1,302 @@
+package eureka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"stator/roster/entity"
+)
+
+func TestEureka(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Eureka Suite")
+}
+
+var _ = Describe("Eureka", func() {
+	var (
+		fake   *fakeEureka
+		client *ClientMock
+		eka    *Eureka
+		ctx    context.Context
+		svc    entity.Service
+		err    error
+	)
+
+	BeforeEach(func() {
+		fake = &fakeEureka{instances: map[string]instance{}, overrides: map[string]string{}}
+		client = &ClientMock{
+			SendObjectFunc: fake.SendObject,
+		}
+
+		eka = (&Config{
+			Renewal:    30 * time.Second,
+			Duration:   90 * time.Second,
+			DataCenter: "MyOwn",
+		}).New(client)
+
+		ctx = context.Background()
+		svc = entity.Service{
+			Id:          "123",
+			Name:        "foobear",
+			Tags:        []string{"one", "two"},
+			IpAddress:   "1.2.3.4",
+			Port:        8082,
+			MonitorSpec: "http://%s:%d/monitor",
+			Meta:        map[string]string{"run-id": "abc"},
+		}
+	})
+
+	Describe("registering", func() {
+
+		JustBeforeEach(func() {
+			err = eka.Register(ctx, svc)
+		})
+
+		When("all goes well", func() {
+			It("posts the instance under its app", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fake.requests).To(Equal([]string{"POST /apps/FOOBEAR"}))
+
+				inst := fake.instances["FOOBEAR/foobear-123"]
+				Expect(inst.LastDirtyTimestamp).ToNot(BeEmpty())
+				inst.LastDirtyTimestamp = ""
+
+				Expect(inst).To(Equal(instance{
+					InstanceId:     "foobear-123",
+					HostName:       "1.2.3.4",
+					App:            "FOOBEAR",
+					IpAddr:         "1.2.3.4",
+					VipAddress:     "foobear",
+					Status:         "UP",
+					Port:           port{Port: 8082, Enabled: "true"},
+					SecurePort:     port{Port: 443, Enabled: "false"},
+					HomePageUrl:    "http://1.2.3.4:8082/",
+					StatusPageUrl:  "http://1.2.3.4:8082/monitor",
+					HealthCheckUrl: "http://1.2.3.4:8082/monitor",
+					DataCenterInfo: dataCenterInfo{Class: dataCenterClass, Name: "MyOwn"},
+					LeaseInfo:      leaseInfo{RenewalIntervalInSecs: 30, DurationInSecs: 90},
+					Metadata:       map[string]string{"run-id": "abc", "tags": "one,two"},
+				}))
+			})
+		})
+
+		When("eureka has trouble", func() {
+			BeforeEach(func() {
+				fake.broken = true
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError("unexpected status: 500"))
+			})
+		})
+	})
+
+	Describe("heartbeating", func() {
+		var (
+			status string
+		)
+
+		BeforeEach(func() {
+			status = entity.Passing
+			Expect(eka.Register(ctx, svc)).To(Succeed())
+		})
+
+		JustBeforeEach(func() {
+			err = eka.Heartbeat(ctx, svc, status, "")
+		})
+
+		When("status is unchanged", func() {
+			It("renews the lease", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fake.requests).To(HaveLen(2))
+				Expect(fake.requests[1]).To(Equal("PUT /apps/FOOBEAR/foobear-123?status=UP"))
+			})
+		})
+
+		When("status has gone critical", func() {
+			BeforeEach(func() {
+				status = entity.Critical
+			})
+
+			It("re-registers as down", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fake.requests).To(HaveLen(2))
+				Expect(fake.requests[1]).To(Equal("POST /apps/FOOBEAR"))
+				Expect(fake.instances["FOOBEAR/foobear-123"].Status).To(Equal("DOWN"))
+			})
+		})
+
+		When("eureka has forgotten the instance", func() {
+			BeforeEach(func() {
+				fake.instances = map[string]instance{}
+			})
+
+			It("re-registers", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fake.requests).To(HaveLen(3))
+				Expect(fake.requests[2]).To(Equal("POST /apps/FOOBEAR"))
+				Expect(fake.instances).To(HaveKey("FOOBEAR/foobear-123"))
+			})
+		})
+
+		When("status is unknown", func() {
+			BeforeEach(func() {
+				status = "bargle"
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(`unknown status "bargle"`))
+			})
+		})
+
+		It("has the renewal period", func() {
+			Expect(eka.HeartbeatPeriod(svc)).To(Equal(30 * time.Second))
+		})
+	})
+
+	Describe("overriding status", func() {
+
+		BeforeEach(func() {
+			Expect(eka.Register(ctx, svc)).To(Succeed())
+		})
+
+		JustBeforeEach(func() {
+			err = eka.Override(ctx, svc, "OUT_OF_SERVICE")
+		})
+
+		When("all goes well", func() {
+			It("sets and clears the override", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fake.requests[1]).To(Equal("PUT /apps/FOOBEAR/foobear-123/status?value=OUT_OF_SERVICE"))
+				Expect(fake.overrides).To(HaveKeyWithValue("FOOBEAR/foobear-123", "OUT_OF_SERVICE"))
+
+				Expect(eka.ClearOverride(ctx, svc)).To(Succeed())
+				Expect(fake.requests[2]).To(Equal("DELETE /apps/FOOBEAR/foobear-123/status?value=UP"))
+				Expect(fake.overrides).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("unregistering and verifying", func() {
+		var (
+			ok bool
+		)
+
+		BeforeEach(func() {
+			Expect(eka.Register(ctx, svc)).To(Succeed())
+
+			ok, err = eka.Registered(ctx, svc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+
+		JustBeforeEach(func() {
+			err = eka.Unregister(ctx, svc)
+		})
+
+		When("all goes well", func() {
+			It("cancels the instance", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fake.instances).To(BeEmpty())
+
+				ok, err = eka.Registered(ctx, svc)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ok).To(BeFalse())
+			})
+		})
+
+		When("already forgotten", func() {
+			BeforeEach(func() {
+				fake.instances = map[string]instance{}
+			})
+
+			It("relays the error", func() {
+				Expect(err).To(MatchError("unexpected status: 404"))
+			})
+		})
+	})
+})
+
+// fakeEureka minimally mimics the eureka REST api, as seen through the client.
+type fakeEureka struct {
+	mu        sync.Mutex
+	instances map[string]instance
+	overrides map[string]string
+	requests  []string
+	broken    bool
+}
+
+func (fake *fakeEureka) SendObject(ctx context.Context, method, path string, snd, rcv any) (err error) {
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.requests = append(fake.requests, method+" "+path)
+	if fake.broken {
+		return fmt.Errorf("unexpected status: 500")
+	}
+
+	uri, err := url.Parse(path)
+	if err != nil {
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(uri.Path, "/apps/"), "/")
+	key := strings.Join(parts[:min(len(parts), 2)], "/")
+
+	var rs any
+	switch {
+	case method == "POST" && len(parts) == 1:
+		rg, ok := snd.(registration)
+		if !ok {
+			return fmt.Errorf("unexpected status: 400")
+		}
+		fake.instances[parts[0]+"/"+rg.Instance.InstanceId] = rg.Instance
+	case method == "GET" && uri.Path == appsPath:
+		apps := map[string][]any{}
+		for k, inst := range fake.instances {
+			name, _, _ := strings.Cut(k, "/")
+			apps[name] = append(apps[name], inst)
+		}
+		list := []any{}
+		for name, insts := range apps {
+			list = append(list, map[string]any{"name": name, "instance": insts})
+		}
+		rs = map[string]any{"applications": map[string]any{"application": list}}
+	case len(parts) == 2:
+		if _, ok := fake.instances[key]; !ok {
+			return fmt.Errorf("unexpected status: 404")
+		}
+		if method == "DELETE" {
+			delete(fake.instances, key)
+		}
+	case len(parts) == 3 && parts[2] == "status":
+		switch method {
+		case "PUT":
+			fake.overrides[key] = uri.Query().Get("value")
+		case "DELETE":
+			delete(fake.overrides, key)
+		}
+	default:
+		return fmt.Errorf("unexpected status: 404")
+	}
+
+	if rcv != nil && rs != nil {
+		var data []byte
+		data, err = json.Marshal(rs)
+		if err != nil {
+			return
+		}
+		err = json.Unmarshal(data, rcv)
+	}
+	return
+}
@@ -0,0 +1,191 @@
+// Package filesd provides for registration via a Prometheus file_sd target file.
+package filesd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"gopkg.in/yaml.v3"
+
+	"stator/roster/entity"
+)
+
+const (
+	idLabel string = "service_id"
+)
+
+// Config is FileSd configuration.
+type Config struct {
+	Path string `json:"path" desc:"target file, yaml when ending in .yml or .yaml, json otherwise" default:"/etc/prometheus/file_sd/stator.json"`
+}
+
+// FileSd maintains a target file shared by any number of processes on a host.
+//
+// Each service is written as its entity.TargetGroup.
+// Updates are serialized across processes with an flock on a sibling ".lock" file
+// and written atomically via rename, so Prometheus never sees a partial file.
+type FileSd struct {
+	Path string
+}
+
+// New creates a FileSd from Config.
+func (cfg *Config) New() *FileSd {
+
+	return &FileSd{
+		Path: cfg.Path,
+	}
+}
+
+// Register upserts the service's target group.
+func (fsd *FileSd) Register(ctx context.Context, svc entity.Service) (err error) {
+
+	grp := svc.TargetGroup()
+
+	err = fsd.update(func(groups []entity.TargetGroup) []entity.TargetGroup {
+
+		for i := range groups {
+			if groups[i].Labels[idLabel] == grp.Labels[idLabel] {
+				groups[i] = grp
+				return groups
+			}
+		}
+
+		return append(groups, grp)
+	})
+	return
+}
+
+// Unregister removes the service's target group.
+func (fsd *FileSd) Unregister(ctx context.Context, svc entity.Service) (err error) {
+
+	err = fsd.update(func(groups []entity.TargetGroup) []entity.TargetGroup {
+
+		kept := []entity.TargetGroup{}
+		for _, grp := range groups {
+			if grp.Labels[idLabel] != svc.NameId() {
+				kept = append(kept, grp)
+			}
+		}
+
+		return kept
+	})
+	return
+}
+
+// Registered checks that the service's target group is present.
+func (fsd *FileSd) Registered(ctx context.Context, svc entity.Service) (ok bool, err error) {
+
+	groups, err := fsd.read()
+	if err != nil {
+		return
+	}
+
+	for _, grp := range groups {
+		if grp.Labels[idLabel] == svc.NameId() {
+			ok = true
+			return
+		}
+	}
+
+	return
+}
+
+// unexported
+
+func (fsd *FileSd) update(modify func(groups []entity.TargetGroup) []entity.TargetGroup) (err error) {
+
+	lock, err := os.OpenFile(fsd.Path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to open lock file for %s", fsd.Path)
+		return
+	}
+	defer lock.Close()
+
+	err = unix.Flock(int(lock.Fd()), unix.LOCK_EX)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to lock %s", fsd.Path)
+		return
+	}
+	defer unix.Flock(int(lock.Fd()), unix.LOCK_UN) //nolint: errcheck
+
+	groups, err := fsd.read()
+	if err != nil {
+		return
+	}
+
+	err = fsd.write(modify(groups))
+	return
+}
+
+func (fsd *FileSd) read() (groups []entity.TargetGroup, err error) {
+
+	groups = []entity.TargetGroup{}
+
+	data, err := os.ReadFile(fsd.Path)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && len(data) == 0) {
+		err = nil
+		return
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read %s", fsd.Path)
+		return
+	}
+
+	// yaml being a superset of json, it will read either
+
+	err = yaml.Unmarshal(data, &groups)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to parse %s", fsd.Path)
+	}
+	return
+}
+
+func (fsd *FileSd) write(groups []entity.TargetGroup) (err error) {
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Labels[idLabel] < groups[j].Labels[idLabel]
+	})
+
+	var data []byte
+	switch filepath.Ext(fsd.Path) {
+	case ".yml", ".yaml":
+		data, err = yaml.Marshal(groups)
+	default:
+		data, err = json.MarshalIndent(groups, "", "  ")
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "failed to marshal target groups")
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(fsd.Path), filepath.Base(fsd.Path)+".*")
+	if err != nil {
+		err = errors.Wrapf(err, "failed to create temp file for %s", fsd.Path)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0o644)
+	}
+	if err == nil {
+		err = tmp.Close()
+	}
+	if err != nil {
+		tmp.Close()
+		err = errors.Wrapf(err, "failed to write temp file for %s", fsd.Path)
+		return
+	}
+
+	err = os.Rename(tmp.Name(), fsd.Path)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to rename temp file to %s", fsd.Path)
+	}
+	return
+}
@@ -0,0 +1,191 @@
+package filesd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"stator/roster/entity"
+)
+
+func TestFileSd(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "FileSd Suite")
+}
+
+var _ = Describe("FileSd", func() {
+	var (
+		dir string
+		fsd *FileSd
+		ctx context.Context
+		svc entity.Service
+		err error
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		fsd = (&Config{Path: filepath.Join(dir, "targets.json")}).New()
+
+		ctx = context.Background()
+		svc = entity.Service{
+			Id:          "123",
+			Name:        "foobear",
+			Tags:        []string{"one", "two"},
+			IpAddress:   "1.2.3.4",
+			Port:        8082,
+			MonitorSpec: "http://%s:%d/monitor",
+			Meta:        map[string]string{"run-id": "abc"},
+		}
+	})
+
+	Describe("registering", func() {
+
+		JustBeforeEach(func() {
+			err = fsd.Register(ctx, svc)
+		})
+
+		When("file does not yet exist", func() {
+			It("writes a target group for the service", func() {
+				Expect(err).ToNot(HaveOccurred())
+
+				data, err := os.ReadFile(fsd.Path)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(MatchJSON(`[{
+					"targets": ["1.2.3.4:8082"],
+					"labels": {
+						"service": "foobear",
+						"service_id": "foobear-123",
+						"tags": ",one,two,",
+						"meta_run_id": "abc"
+					}
+				}]`))
+			})
+		})
+
+		When("service and others are already registered", func() {
+			BeforeEach(func() {
+				Expect(os.WriteFile(fsd.Path, []byte(`[
+					{"targets": ["1.2.3.4:8081"], "labels": {"service_id": "foobear-123"}},
+					{"targets": ["5.6.7.8:9100"], "labels": {"job": "node"}}
+				]`), 0o644)).To(Succeed())
+			})
+
+			It("replaces its group and keeps the others", func() {
+				Expect(err).ToNot(HaveOccurred())
+
+				data, err := os.ReadFile(fsd.Path)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(MatchJSON(`[
+					{"targets": ["5.6.7.8:9100"], "labels": {"job": "node"}},
+					{
+						"targets": ["1.2.3.4:8082"],
+						"labels": {"service": "foobear", "service_id": "foobear-123", "tags": ",one,two,", "meta_run_id": "abc"}
+					}
+				]`))
+			})
+		})
+
+		When("file is yaml", func() {
+			BeforeEach(func() {
+				fsd.Path = filepath.Join(dir, "targets.yml")
+			})
+
+			It("writes yaml", func() {
+				Expect(err).ToNot(HaveOccurred())
+
+				data, err := os.ReadFile(fsd.Path)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(MatchYAML(`
+- targets: ["1.2.3.4:8082"]
+  labels:
+    service: foobear
+    service_id: foobear-123
+    tags: ",one,two,"
+    meta_run_id: abc
+`))
+			})
+		})
+
+		When("file is garbage", func() {
+			BeforeEach(func() {
+				Expect(os.WriteFile(fsd.Path, []byte(`{"not": "a list"`), 0o644)).To(Succeed())
+			})
+
+			It("errors and leaves it be", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to parse")))
+
+				data, err := os.ReadFile(fsd.Path)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(data)).To(Equal(`{"not": "a list"`))
+			})
+		})
+
+		When("many processes register at once", func() {
+			BeforeEach(func() {
+				var wg sync.WaitGroup
+				for i := 0; i < 20; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						defer GinkgoRecover()
+
+						other := svc
+						other.Id = fmt.Sprintf("other%02d", i)
+						Expect((&Config{Path: fsd.Path}).New().Register(ctx, other)).To(Succeed())
+					}(i)
+				}
+				wg.Wait()
+			})
+
+			It("loses none of them", func() {
+				Expect(err).ToNot(HaveOccurred())
+
+				groups, err := fsd.read()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(groups).To(HaveLen(21))
+			})
+		})
+	})
+
+	Describe("unregistering and verifying", func() {
+		var (
+			ok bool
+		)
+
+		BeforeEach(func() {
+			other := svc
+			other.Id = "456"
+			Expect(fsd.Register(ctx, other)).To(Succeed())
+			Expect(fsd.Register(ctx, svc)).To(Succeed())
+
+			ok, err = fsd.Registered(ctx, svc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+
+		JustBeforeEach(func() {
+			err = fsd.Unregister(ctx, svc)
+		})
+
+		When("all goes well", func() {
+			It("removes the service's group only", func() {
+				Expect(err).ToNot(HaveOccurred())
+
+				ok, err = fsd.Registered(ctx, svc)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ok).To(BeFalse())
+
+				groups, err := fsd.read()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(groups).To(HaveLen(1))
+				Expect(groups[0].Labels["service_id"]).To(Equal("foobear-456"))
+			})
+		})
+	})
+})
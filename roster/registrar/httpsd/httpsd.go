@@ -0,0 +1,180 @@
+// Package httpsd provides for registration with a stator instance acting as a
+// Prometheus http_sd registry, along with the registry itself.
+package httpsd
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"stator/roster/entity"
+)
+
+//go:generate moq -out mock_test.go . Client Router Logger
+
+const (
+	registerPath   string = "/sd/register"
+	deregisterPath string = "/sd/deregister"
+	targetsPath    string = "/sd/targets"
+)
+
+// Client specifies an http client.
+type Client interface {
+	SendObject(ctx context.Context, method, path string, snd, rcv any) (err error)
+}
+
+// Config is HttpSd configuration.
+type Config struct {
+	Refresh time.Duration   `json:"refresh_interval" desc:"re-registration period, well under the registry's ttl" default:"20s"`
+	Token   entity.Redacted `json:"token" desc:"bearer token shared with the registry"`
+}
+
+// HttpSd is a client of a stator registry.
+//
+// Registrations expire unless refreshed, so the service is re-registered via Heartbeat.
+// While the last heartbeat was critical, the registration is left to expire, with Register
+// skipping the post and Registered reporting true, so that neither periodic nor verifying
+// re-registration puts the unhealthy service back.
+type HttpSd struct {
+	Client  Client
+	Refresh time.Duration
+
+	mu       sync.Mutex
+	critical map[string]bool
+}
+
+// New creates an HttpSd from Config.
+func (cfg *Config) New(client Client) *HttpSd {
+
+	return &HttpSd{
+		Client:  client,
+		Refresh: cfg.Refresh,
+	}
+}
+
+// Tripper creates a BearerRt from Config, for wrapping into the client passed to New.
+func (cfg *Config) Tripper() *BearerRt {
+
+	return &BearerRt{
+		Token: string(cfg.Token),
+	}
+}
+
+// Register posts the service to the registry, unless critical.
+func (hsd *HttpSd) Register(ctx context.Context, svc entity.Service) (err error) {
+
+	if hsd.isCritical(svc) {
+		return
+	}
+
+	err = hsd.Client.SendObject(ctx, "POST", registerPath, svc, nil)
+	return
+}
+
+// Unregister posts the service to the registry for removal.
+func (hsd *HttpSd) Unregister(ctx context.Context, svc entity.Service) (err error) {
+
+	hsd.setCritical(svc, false)
+
+	err = hsd.Client.SendObject(ctx, "POST", deregisterPath, svc, nil)
+	return
+}
+
+// Registered checks that the service is among the registry's targets, or is critical
+// and so meant to be absent.
+func (hsd *HttpSd) Registered(ctx context.Context, svc entity.Service) (ok bool, err error) {
+
+	if hsd.isCritical(svc) {
+		ok = true
+		return
+	}
+
+	groups := []entity.TargetGroup{}
+
+	err = hsd.Client.SendObject(ctx, "GET", targetsPath, nil, &groups)
+	if err != nil {
+		return
+	}
+
+	for _, grp := range groups {
+		if grp.Labels[idLabel] == svc.NameId() {
+			ok = true
+			return
+		}
+	}
+
+	return
+}
+
+// HeartbeatPeriod returns the refresh period.
+func (hsd *HttpSd) HeartbeatPeriod(svc entity.Service) time.Duration {
+
+	return hsd.Refresh
+}
+
+// Heartbeat refreshes the registration.
+//
+// A critical service is not refreshed, leaving the registry to expire it.
+func (hsd *HttpSd) Heartbeat(ctx context.Context, svc entity.Service, status, note string) (err error) {
+
+	hsd.setCritical(svc, status == entity.Critical)
+
+	err = hsd.Register(ctx, svc)
+	return
+}
+
+// BearerRt is a round tripper setting the Authorization header, suitable for use with giant.
+type BearerRt struct {
+	Token string
+	next  http.RoundTripper
+}
+
+// Wrap sets the next round tripper.
+func (rt *BearerRt) Wrap(next http.RoundTripper) {
+
+	rt.next = next
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *BearerRt) RoundTrip(request *http.Request) (response *http.Response, err error) {
+
+	if rt.Token != "" {
+		request = request.Clone(request.Context())
+		request.Header.Set("Authorization", "Bearer "+rt.Token)
+	}
+
+	next := rt.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	response, err = next.RoundTrip(request)
+	return
+}
+
+// unexported
+
+func (hsd *HttpSd) isCritical(svc entity.Service) bool {
+
+	hsd.mu.Lock()
+	defer hsd.mu.Unlock()
+
+	return hsd.critical[svc.NameId()]
+}
+
+func (hsd *HttpSd) setCritical(svc entity.Service, critical bool) {
+
+	hsd.mu.Lock()
+	defer hsd.mu.Unlock()
+
+	if !critical {
+		delete(hsd.critical, svc.NameId())
+		return
+	}
+
+	if hsd.critical == nil {
+		hsd.critical = map[string]bool{}
+	}
+	hsd.critical[svc.NameId()] = true
+}
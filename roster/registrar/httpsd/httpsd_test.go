@@ -0,0 +1,358 @@
+package httpsd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"stator/roster"
+	"stator/roster/entity"
+)
+
+func TestHttpSd(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "HttpSd Suite")
+}
+
+var _ = Describe("HttpSd", func() {
+	var (
+		routes map[string]http.HandlerFunc
+		rtr    *RouterMock
+		lgr    *LoggerMock
+		reg    *Registry
+		client *ClientMock
+		token  string
+		hsd    *HttpSd
+		ctx    context.Context
+		svc    entity.Service
+		err    error
+	)
+
+	BeforeEach(func() {
+		routes = map[string]http.HandlerFunc{}
+		rtr = &RouterMock{
+			HandleFuncFunc: func(pattern string, handler http.HandlerFunc) {
+				routes[pattern] = handler
+			},
+		}
+		lgr = &LoggerMock{
+			ErrorFunc: func(ctx context.Context, msg string, err error, kv ...any) {},
+		}
+		reg = (&RegistryConfig{Ttl: time.Minute, Token: "s3cr3t"}).New(rtr, lgr)
+
+		token = "s3cr3t"
+		client = &ClientMock{
+			SendObjectFunc: func(ctx context.Context, method, path string, snd, rcv any) error {
+				return serve(routes, token, method, path, snd, rcv)
+			},
+		}
+		hsd = (&Config{Refresh: 20 * time.Second}).New(client)
+
+		ctx = context.Background()
+		svc = entity.Service{
+			Id:          "123",
+			Name:        "foobear",
+			Tags:        []string{"one", "two"},
+			IpAddress:   "1.2.3.4",
+			Port:        8082,
+			MonitorSpec: "http://%s:%d/monitor",
+		}
+	})
+
+	Describe("creating a registry", func() {
+		It("routes its handlers", func() {
+			Expect(routes).To(HaveKey("POST /sd/register"))
+			Expect(routes).To(HaveKey("POST /sd/deregister"))
+			Expect(routes).To(HaveKey("GET /sd/targets"))
+		})
+	})
+
+	Describe("registering", func() {
+
+		JustBeforeEach(func() {
+			err = hsd.Register(ctx, svc)
+		})
+
+		When("all goes well", func() {
+			It("serves the service as a target group", func() {
+				Expect(err).ToNot(HaveOccurred())
+
+				rec := httptest.NewRecorder()
+				routes["GET /sd/targets"](rec, httptest.NewRequest("GET", "/sd/targets", nil))
+
+				Expect(rec.Code).To(Equal(http.StatusOK))
+				Expect(rec.Header().Get("Content-Type")).To(Equal("application/json"))
+				Expect(rec.Body.String()).To(MatchJSON(`[{
+					"targets": ["1.2.3.4:8082"],
+					"labels": {"service": "foobear", "service_id": "foobear-123", "tags": ",one,two,"}
+				}]`))
+			})
+		})
+
+		When("service is invalid", func() {
+			BeforeEach(func() {
+				svc.IpAddress = "bargle"
+			})
+
+			It("is refused", func() {
+				Expect(err).To(MatchError(ContainSubstring("400")))
+				Expect(reg.Targets()).To(BeEmpty())
+				Expect(lgr.ErrorCalls()).To(HaveLen(1))
+			})
+		})
+
+		When("token is wrong", func() {
+			BeforeEach(func() {
+				token = "bargle"
+			})
+
+			It("is refused", func() {
+				Expect(err).To(MatchError(ContainSubstring("401")))
+				Expect(reg.Targets()).To(BeEmpty())
+				Expect(lgr.ErrorCalls()[0].Msg).To(Equal("unauthorized registration request"))
+			})
+		})
+
+		When("registry has no token", func() {
+			BeforeEach(func() {
+				reg.Token = ""
+				token = ""
+			})
+
+			It("is refused", func() {
+				Expect(err).To(MatchError(ContainSubstring("401")))
+				Expect(reg.Targets()).To(BeEmpty())
+			})
+		})
+
+		When("not refreshed within ttl", func() {
+			BeforeEach(func() {
+				reg.Ttl = 10 * time.Millisecond
+			})
+
+			It("expires", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(reg.Targets()).To(HaveLen(1))
+
+				Eventually(reg.Targets).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("heartbeating", func() {
+
+		BeforeEach(func() {
+			reg.Ttl = 50 * time.Millisecond
+			Expect(hsd.Register(ctx, svc)).To(Succeed())
+			time.Sleep(30 * time.Millisecond)
+		})
+
+		When("passing", func() {
+			JustBeforeEach(func() {
+				err = hsd.Heartbeat(ctx, svc, entity.Passing, "")
+			})
+
+			It("refreshes the registration", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Consistently(reg.Targets, 40*time.Millisecond).Should(HaveLen(1))
+			})
+		})
+
+		When("critical", func() {
+			JustBeforeEach(func() {
+				err = hsd.Heartbeat(ctx, svc, entity.Critical, "all collectors failed")
+			})
+
+			It("lets the registration expire", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(client.SendObjectCalls()).To(HaveLen(1))
+				Eventually(reg.Targets).Should(BeEmpty())
+			})
+		})
+
+		It("has the refresh period", func() {
+			Expect(hsd.HeartbeatPeriod(svc)).To(Equal(20 * time.Second))
+		})
+	})
+
+	Describe("heartbeating and verifying from a roster", func() {
+		var (
+			health string
+			rstr   *roster.Roster
+			cancel context.CancelFunc
+			wg     sync.WaitGroup
+		)
+
+		BeforeEach(func() {
+			reg.Ttl = 50 * time.Millisecond
+			hsd.Refresh = 10 * time.Millisecond
+
+			health = entity.Passing
+			var mu sync.Mutex
+
+			rstr = &roster.Roster{
+				Registrar:      hsd,
+				Logger:         &nopLogger{},
+				Service:        svc,
+				Interval:       time.Hour,
+				VerifyInterval: 10 * time.Millisecond,
+				Health: func(ctx context.Context) (string, string) {
+					mu.Lock()
+					defer mu.Unlock()
+					return health, ""
+				},
+			}
+
+			var rctx context.Context
+			rctx, cancel = context.WithCancel(ctx)
+			rstr.Start(rctx, &wg)
+			Eventually(reg.Targets).Should(HaveLen(1))
+
+			mu.Lock()
+			health = entity.Critical
+			mu.Unlock()
+		})
+
+		AfterEach(func() {
+			cancel()
+			wg.Wait()
+		})
+
+		It("lets the critical registration expire and stay expired", func() {
+			Eventually(reg.Targets).Should(BeEmpty())
+			Consistently(reg.Targets, 150*time.Millisecond).Should(BeEmpty())
+			Expect(rstr.Status().State).To(Equal("registered"))
+		})
+	})
+
+	Describe("unregistering and verifying", func() {
+		var (
+			ok bool
+		)
+
+		BeforeEach(func() {
+			other := svc
+			other.Id = "456"
+			Expect(hsd.Register(ctx, other)).To(Succeed())
+			Expect(hsd.Register(ctx, svc)).To(Succeed())
+
+			ok, err = hsd.Registered(ctx, svc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+
+		JustBeforeEach(func() {
+			err = hsd.Unregister(ctx, svc)
+		})
+
+		When("all goes well", func() {
+			It("removes the service only", func() {
+				Expect(err).ToNot(HaveOccurred())
+
+				ok, err = hsd.Registered(ctx, svc)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ok).To(BeFalse())
+
+				groups := reg.Targets()
+				Expect(groups).To(HaveLen(1))
+				Expect(groups[0].Labels["service_id"]).To(Equal("foobear-456"))
+			})
+		})
+
+		When("client has trouble", func() {
+			BeforeEach(func() {
+				client.SendObjectFunc = func(ctx context.Context, method, path string, snd, rcv any) error {
+					return fmt.Errorf("oops")
+				}
+			})
+
+			It("relays the error", func() {
+				Expect(err).To(MatchError("oops"))
+			})
+		})
+	})
+})
+
+var _ = Describe("BearerRt", func() {
+	var (
+		server *httptest.Server
+		got    string
+		rt     *BearerRt
+		err    error
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			got = request.Header.Get("Authorization")
+		}))
+		DeferCleanup(server.Close)
+
+		rt = (&Config{Token: "s3cr3t"}).Tripper()
+	})
+
+	JustBeforeEach(func() {
+		var response *http.Response
+		response, err = (&http.Client{Transport: rt}).Get(server.URL)
+		if err == nil {
+			response.Body.Close()
+		}
+	})
+
+	When("all goes well", func() {
+		It("sets the bearer token", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(got).To(Equal("Bearer s3cr3t"))
+		})
+	})
+})
+
+// serve round-trips json through the routed handlers as would the real client and router.
+func serve(routes map[string]http.HandlerFunc, token, method, path string, snd, rcv any) (err error) {
+
+	handler, ok := routes[method+" "+path]
+	if !ok {
+		return fmt.Errorf("no route for %s %s", method, path)
+	}
+
+	body := &bytes.Buffer{}
+	if snd != nil {
+		err = json.NewEncoder(body).Encode(snd)
+		if err != nil {
+			return
+		}
+	}
+
+	request := httptest.NewRequest(method, path, body)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, request)
+
+	if rec.Code != http.StatusOK {
+		return fmt.Errorf("unexpected status: %d", rec.Code)
+	}
+
+	if rcv != nil {
+		err = json.Unmarshal(rec.Body.Bytes(), rcv)
+	}
+	return
+}
+
+type nopLogger struct{}
+
+func (nl *nopLogger) Info(ctx context.Context, msg string, kv ...any)             {}
+func (nl *nopLogger) Error(ctx context.Context, msg string, err error, kv ...any) {}
+func (nl *nopLogger) WithFields(ctx context.Context, kv ...any) context.Context {
+	return ctx
+}
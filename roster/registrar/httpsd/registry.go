@@ -0,0 +1,189 @@
+package httpsd
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"stator/roster/entity"
+)
+
+const (
+	idLabel string = "service_id"
+)
+
+// Router specifies an http router.
+type Router interface {
+	HandleFunc(pattern string, handler http.HandlerFunc)
+}
+
+// Logger specifies a logger.
+type Logger interface {
+	Error(ctx context.Context, msg string, err error, kv ...any)
+}
+
+// RegistryConfig is Registry configuration.
+type RegistryConfig struct {
+	Serve bool            `json:"serve" desc:"act as registry for other instances"`
+	Ttl   time.Duration   `json:"ttl" desc:"time after which an unrefreshed registration expires" default:"1m"`
+	Token entity.Redacted `json:"token" desc:"bearer token shared with registering instances, refusing all when blank"`
+}
+
+// Registry keeps registrations from HttpSd clients and serves them to Prometheus
+// in http_sd format, forgetting those not refreshed within Ttl.
+//
+// Registering and deregistering require Token as a bearer token, while targets are open to all.
+type Registry struct {
+	Ttl    time.Duration
+	Token  string
+	Logger Logger
+
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+// New creates a Registry from Config, routing its handlers.
+// Serve is not consulted here, callers check it before calling New.
+func (cfg *RegistryConfig) New(rtr Router, lgr Logger) (reg *Registry) {
+
+	reg = &Registry{
+		Ttl:     cfg.Ttl,
+		Token:   string(cfg.Token),
+		Logger:  lgr,
+		entries: map[string]entry{},
+	}
+
+	rtr.HandleFunc("POST "+registerPath, reg.PostRegister)
+	rtr.HandleFunc("POST "+deregisterPath, reg.PostDeregister)
+	rtr.HandleFunc("GET "+targetsPath, reg.GetTargets)
+
+	return
+}
+
+// PostRegister handles http requests to register a service.
+func (reg *Registry) PostRegister(writer http.ResponseWriter, request *http.Request) {
+
+	svc, ok := reg.decode(writer, request)
+	if !ok {
+		return
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	reg.entries[svc.NameId()] = entry{
+		group:   svc.TargetGroup(),
+		expires: time.Now().Add(reg.Ttl),
+	}
+}
+
+// PostDeregister handles http requests to unregister a service.
+func (reg *Registry) PostDeregister(writer http.ResponseWriter, request *http.Request) {
+
+	svc, ok := reg.decode(writer, request)
+	if !ok {
+		return
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	delete(reg.entries, svc.NameId())
+}
+
+// GetTargets handles http requests for targets in Prometheus http_sd format.
+func (reg *Registry) GetTargets(writer http.ResponseWriter, request *http.Request) {
+
+	ctx := request.Context()
+
+	data, err := json.Marshal(reg.Targets())
+	if err != nil {
+		reg.Logger.Error(ctx, "failed to marshal targets", err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	_, err = writer.Write(data)
+	if err != nil {
+		reg.Logger.Error(ctx, "failed to write targets to response", err)
+	}
+}
+
+// Targets returns unexpired target groups, pruning those expired.
+func (reg *Registry) Targets() (groups []entity.TargetGroup) {
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	now := time.Now()
+	groups = []entity.TargetGroup{}
+
+	for id, ent := range reg.entries {
+		if now.After(ent.expires) {
+			delete(reg.entries, id)
+			continue
+		}
+		groups = append(groups, ent.group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Labels[idLabel] < groups[j].Labels[idLabel]
+	})
+
+	return
+}
+
+// unexported
+
+type entry struct {
+	group   entity.TargetGroup
+	expires time.Time
+}
+
+func (reg *Registry) decode(writer http.ResponseWriter, request *http.Request) (svc entity.Service, ok bool) {
+
+	ctx := request.Context()
+
+	if !reg.authorized(request) {
+		reg.Logger.Error(ctx, "unauthorized registration request", errors.Errorf("bad or missing bearer token"))
+		writer.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := json.NewDecoder(request.Body).Decode(&svc)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to decode service")
+	}
+	if err == nil {
+		err = svc.Valid()
+	}
+	if err != nil {
+		reg.Logger.Error(ctx, "bad registration request", err)
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ok = true
+	return
+}
+
+func (reg *Registry) authorized(request *http.Request) bool {
+
+	// a blank token authorizes nothing
+
+	token, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+	if !ok || reg.Token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(reg.Token)) == 1
+}
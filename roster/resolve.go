@@ -0,0 +1,188 @@
+package roster
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ResolverConfig is Resolver configuration.
+type ResolverConfig struct {
+	Interface string   `json:"interface" desc:"select from this interface only, such as eth0"`
+	Cidrs     []string `json:"cidrs" desc:"select from addresses within these cidrs only, such as 10.0.0.0/8"`
+	Prefer    string   `json:"prefer" desc:"address family to prefer, ipv4 or ipv6" default:"ipv4"`
+}
+
+// Resolver selects an ip address from those of the host's interfaces, without
+// touching the network.
+//
+// Loopback and down interfaces are skipped unless named, as are link-local addresses
+// unless allowed by Cidrs.
+// Of the remaining, the first of the preferred family wins, falling back to the other.
+type Resolver struct {
+	Interface string
+	Cidrs     []string
+	Prefer    string
+
+	addrs func() ([]ifaceAddr, error)
+}
+
+// New creates a Resolver from Config.
+func (cfg *ResolverConfig) New() *Resolver {
+
+	return &Resolver{
+		Interface: cfg.Interface,
+		Cidrs:     cfg.Cidrs,
+		Prefer:    cfg.Prefer,
+	}
+}
+
+// Resolve returns the selected ip address.
+func (rsv *Resolver) Resolve() (ip string, err error) {
+
+	nets, err := parseCidrs(rsv.Cidrs)
+	if err != nil {
+		return
+	}
+
+	var v6 bool
+	switch strings.ToLower(rsv.Prefer) {
+	case "", "ipv4":
+	case "ipv6":
+		v6 = true
+	default:
+		err = errors.Errorf("unknown address family preference %q, expected ipv4 or ipv6", rsv.Prefer)
+		return
+	}
+
+	addrs := rsv.addrs
+	if addrs == nil {
+		addrs = interfaceAddrs
+	}
+
+	all, err := addrs()
+	if err != nil {
+		return
+	}
+
+	candidates := []net.IP{}
+	found := false
+	for _, ia := range all {
+		if rsv.Interface != "" {
+			if ia.name != rsv.Interface {
+				continue
+			}
+			found = true
+		} else if ia.flags&net.FlagUp == 0 || ia.flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		if !allowed(ia.ip, nets) {
+			continue
+		}
+		candidates = append(candidates, ia.ip)
+	}
+
+	if rsv.Interface != "" && !found {
+		err = errors.Errorf("no interface named %q with addresses", rsv.Interface)
+		return
+	}
+	if len(candidates) == 0 {
+		err = errors.Errorf("no address found on %s within %s", rsv.describeIface(), rsv.describeCidrs())
+		return
+	}
+
+	// stable, so interface order stands within family
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		iv4 := candidates[i].To4() != nil
+		jv4 := candidates[j].To4() != nil
+		return iv4 != jv4 && iv4 != v6
+	})
+
+	ip = candidates[0].String()
+	return
+}
+
+// unexported
+
+type ifaceAddr struct {
+	name  string
+	flags net.Flags
+	ip    net.IP
+}
+
+func interfaceAddrs() (all []ifaceAddr, err error) {
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		err = errors.Wrapf(err, "failed to list interfaces")
+		return
+	}
+
+	for _, iface := range ifaces {
+		var addrs []net.Addr
+		addrs, err = iface.Addrs()
+		if err != nil {
+			err = errors.Wrapf(err, "failed to list addresses for %s", iface.Name)
+			return
+		}
+
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			all = append(all, ifaceAddr{name: iface.Name, flags: iface.Flags, ip: ipNet.IP})
+		}
+	}
+
+	return
+}
+
+func parseCidrs(cidrs []string) (nets []*net.IPNet, err error) {
+
+	for _, cidr := range cidrs {
+		var ipNet *net.IPNet
+		_, ipNet, err = net.ParseCIDR(cidr)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse cidr")
+			return
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return
+}
+
+func allowed(ip net.IP, nets []*net.IPNet) bool {
+
+	if len(nets) == 0 {
+		return !ip.IsLinkLocalUnicast()
+	}
+
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rsv *Resolver) describeIface() string {
+
+	if rsv.Interface == "" {
+		return "any interface"
+	}
+	return rsv.Interface
+}
+
+func (rsv *Resolver) describeCidrs() string {
+
+	if len(rsv.Cidrs) == 0 {
+		return "any cidr"
+	}
+	return strings.Join(rsv.Cidrs, ", ")
+}
@@ -0,0 +1,142 @@
+package roster
+
+import (
+	"fmt"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resolver", func() {
+	var (
+		rsv *Resolver
+		ip  string
+		err error
+	)
+
+	BeforeEach(func() {
+		up := net.FlagUp | net.FlagBroadcast
+
+		rsv = (&ResolverConfig{Prefer: "ipv4"}).New()
+		rsv.addrs = func() ([]ifaceAddr, error) {
+			return []ifaceAddr{
+				{name: "lo", flags: net.FlagUp | net.FlagLoopback, ip: net.ParseIP("127.0.0.1")},
+				{name: "eth0", flags: up, ip: net.ParseIP("fe80::1")},
+				{name: "eth0", flags: up, ip: net.ParseIP("fd00::2")},
+				{name: "eth0", flags: up, ip: net.ParseIP("192.0.2.2")},
+				{name: "eth1", flags: 0, ip: net.ParseIP("10.0.0.9")},
+				{name: "docker0", flags: up, ip: net.ParseIP("172.17.0.1")},
+			}, nil
+		}
+	})
+
+	JustBeforeEach(func() {
+		ip, err = rsv.Resolve()
+	})
+
+	When("all goes well", func() {
+		It("selects the first v4 address of an up, non-loopback interface", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ip).To(Equal("192.0.2.2"))
+		})
+	})
+
+	When("preferring ipv6", func() {
+		BeforeEach(func() {
+			rsv.Prefer = "ipv6"
+		})
+
+		It("selects a non link-local v6 address", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ip).To(Equal("fd00::2"))
+		})
+	})
+
+	When("selecting by interface", func() {
+		BeforeEach(func() {
+			rsv.Interface = "docker0"
+		})
+
+		It("selects from that interface only", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ip).To(Equal("172.17.0.1"))
+		})
+	})
+
+	When("selecting by cidr", func() {
+		BeforeEach(func() {
+			rsv.Cidrs = []string{"172.16.0.0/12", "fe80::/10"}
+			rsv.Prefer = "ipv6"
+		})
+
+		It("selects from within the allow-list, link-local included when listed", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ip).To(Equal("fe80::1"))
+		})
+	})
+
+	When("the named interface does not exist", func() {
+		BeforeEach(func() {
+			rsv.Interface = "wlan0"
+		})
+
+		It("errors", func() {
+			Expect(err).To(MatchError(`no interface named "wlan0" with addresses`))
+		})
+	})
+
+	When("nothing is within the allow-list", func() {
+		BeforeEach(func() {
+			rsv.Interface = "eth0"
+			rsv.Cidrs = []string{"10.0.0.0/8"}
+		})
+
+		It("errors", func() {
+			Expect(err).To(MatchError("no address found on eth0 within 10.0.0.0/8"))
+		})
+	})
+
+	When("a cidr is garbage", func() {
+		BeforeEach(func() {
+			rsv.Cidrs = []string{"10.0.0.0/88"}
+		})
+
+		It("errors", func() {
+			Expect(err).To(MatchError(ContainSubstring("failed to parse cidr")))
+		})
+	})
+
+	When("preference is garbage", func() {
+		BeforeEach(func() {
+			rsv.Prefer = "ipx"
+		})
+
+		It("errors", func() {
+			Expect(err).To(MatchError(`unknown address family preference "ipx", expected ipv4 or ipv6`))
+		})
+	})
+
+	When("interfaces cannot be listed", func() {
+		BeforeEach(func() {
+			rsv.addrs = func() ([]ifaceAddr, error) {
+				return nil, fmt.Errorf("oops")
+			}
+		})
+
+		It("errors", func() {
+			Expect(err).To(MatchError("oops"))
+		})
+	})
+
+	When("using the host's own interfaces", func() {
+		BeforeEach(func() {
+			rsv.addrs = nil
+		})
+
+		It("resolves without dialing out", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(net.ParseIP(ip)).ToNot(BeNil())
+		})
+	})
+})
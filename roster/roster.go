@@ -3,16 +3,25 @@ package roster
 
 import (
 	"context"
-	"net"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/clarktrimble/hondo"
+	"github.com/pkg/errors"
 
+	ste "stator/entity"
 	"stator/roster/entity"
 )
 
-//go:generate moq -out mock_test.go . Registrar Logger
+//go:generate moq -out mock_test.go . Registrar Heartbeater Verifier Maintainer Logger Discoverer
 
 // Registrar specifies a registration interface.
 type Registrar interface {
@@ -20,6 +29,22 @@ type Registrar interface {
 	Unregister(ctx context.Context, svc entity.Service) (err error)
 }
 
+// Heartbeater specifies a registrar needing periodic health updates, such as for a ttl check.
+type Heartbeater interface {
+	HeartbeatPeriod(svc entity.Service) (period time.Duration)
+	Heartbeat(ctx context.Context, svc entity.Service, status, note string) (err error)
+}
+
+// Verifier specifies a registrar able to confirm that a service is registered.
+type Verifier interface {
+	Registered(ctx context.Context, svc entity.Service) (ok bool, err error)
+}
+
+// Maintainer specifies a registrar able to take a service out of rotation without unregistering it.
+type Maintainer interface {
+	Maintenance(ctx context.Context, svc entity.Service, enable bool, reason string) (err error)
+}
+
 // Logger specifies a logging interface.
 type Logger interface {
 	Info(ctx context.Context, msg string, kv ...any)
@@ -29,58 +54,193 @@ type Logger interface {
 
 // ServiceConfig is configuration for service to be registered.
 type ServiceConfig struct {
-	Id          string   `json:"id" desc:"unique to service id" required:"true"`
-	Name        string   `json:"name" desc:"name" required:"true"`
-	Tags        []string `json:"tags" desc:"tags"`
-	IpAddress   string   `json:"ip_address" desc:"ip address of service" default:"lookup"`
-	MonitorSpec string   `json:"monitor_spec" desc:"specifier for monitor endpoint uri" default:"http://%s:%d/monitor"`
+	Id                string            `json:"id" desc:"unique to service id" required:"true"`
+	Name              string            `json:"name" desc:"name" required:"true"`
+	Tags              []string          `json:"tags" desc:"tags"`
+	IpAddress         string            `json:"ip_address" desc:"ip address of service, or lookup to resolve from interfaces" default:"lookup"`
+	MonitorSpec       string            `json:"monitor_spec" desc:"specifier for monitor endpoint uri" default:"http://%s:%d/monitor"`
+	Meta              map[string]string `json:"meta" desc:"metadata as key:value pairs, such as version or run_id"`
+	Weights           *WeightsConfig    `json:"weights"`
+	EnableTagOverride bool              `json:"enable_tag_override" desc:"allow tags to be modified from outside"`
+	Checks            []CheckConfig     `json:"checks" desc:"additional checks as kind;target;interval[;timeout], kind in http, tcp, grpc or ttl"`
+}
+
+// WeightsConfig is configuration for service weights.
+type WeightsConfig struct {
+	Passing int `json:"passing" desc:"weight when passing, zero for registrar default"`
+	Warning int `json:"warning" desc:"weight when warning, zero for registrar default"`
+}
+
+// CheckConfig is configuration for an additional check.
+type CheckConfig struct {
+	Kind     string        `json:"kind"`
+	Target   string        `json:"target"`
+	Interval time.Duration `json:"interval"`
+	Timeout  time.Duration `json:"timeout"`
+}
+
+// Decode decodes a check from "kind;target;interval[;timeout]", implementing envconfig.Decoder.
+//
+// For example: "tcp;%s:%d;30s;5s" or "ttl;;1m".
+func (cc *CheckConfig) Decode(value string) (err error) {
+
+	fields := strings.Split(value, ";")
+	if len(fields) < 3 || len(fields) > 4 {
+		err = errors.Errorf("expected kind;target;interval[;timeout], got: %s", value)
+		return
+	}
+
+	cc.Kind = fields[0]
+	cc.Target = fields[1]
+
+	cc.Interval, err = time.ParseDuration(fields[2])
+	if err != nil {
+		err = errors.Wrapf(err, "failed to parse check interval")
+		return
+	}
+
+	if len(fields) == 4 {
+		cc.Timeout, err = time.ParseDuration(fields[3])
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse check timeout")
+		}
+	}
+
+	return
 }
 
 // Config is Roster configuration.
 type Config struct {
-	Interval time.Duration  `json:"reregister_interval" desc:"reregister period" default:"15m"`
-	Service  *ServiceConfig `json:"service"`
+	Interval        time.Duration   `json:"reregister_interval" desc:"reregister period" default:"15m"`
+	VerifyInterval  time.Duration   `json:"verify_interval" desc:"registration verify period, zero to disable" default:"30s"`
+	BackoffMin      time.Duration   `json:"backoff_min" desc:"first retry delay after failed registration, zero to disable" default:"1s"`
+	BackoffMax      time.Duration   `json:"backoff_max" desc:"max retry delay after failed registration" default:"2m"`
+	Drain           time.Duration   `json:"drain_delay" desc:"wait after taking service out of rotation before unregistering on shutdown, zero to disable"`
+	ResolveInterval time.Duration   `json:"resolve_interval" desc:"ip address re-resolve period when looked up, zero to disable" default:"1m"`
+	MaintenanceApi  bool            `json:"maintenance_api" desc:"serve the unauthenticated maintenance toggle, for trusted networks only"`
+	Service         *ServiceConfig  `json:"service"`
+	Resolver        *ResolverConfig `json:"ip_resolver"`
 }
 
 // Roster repeatedly registers a service and unregisters when stopped.
+//
+// Failed registrations are retried with exponential backoff and jitter between
+// BackoffMin and BackoffMax.
+// When Registrar is also a Verifier, registration is checked every VerifyInterval
+// and the service re-registered straight away if found missing.
+// When Registrar is also a Heartbeater, Health is reported to it periodically,
+// with passing assumed when Health is nil.
+// On shutdown with Drain set, the service is first taken out of rotation, via maintenance
+// mode when Registrar is also a Maintainer and by unregistering otherwise, and the worker
+// stops Drain later, or sooner on a further interrupt or term signal, giving clients time
+// to move on while in-flight requests complete.
+// Stopped is closed once the worker has stopped, for holding off shutting down the
+// http server until then.
+// When Resolver is set and the service has no ip address, one is resolved on Start,
+// and again every ResolveInterval, re-registering under the new address on change.
+// The port is as given to New and is not re-detected.
+// Service is not to be modified once started, being read under lock thereafter.
 type Roster struct {
-	Registrar Registrar
-	Logger    Logger
-	Service   entity.Service
-	Interval  time.Duration
+	Registrar       Registrar
+	Logger          Logger
+	Service         entity.Service
+	Resolver        *Resolver
+	Interval        time.Duration
+	VerifyInterval  time.Duration
+	BackoffMin      time.Duration
+	BackoffMax      time.Duration
+	ResolveInterval time.Duration
+	Drain           time.Duration
+	Health          func(ctx context.Context) (status, note string)
+
+	mu      sync.Mutex
+	status  Status
+	stopped chan struct{}
+	signals func() (sigs <-chan os.Signal, stop func())
+}
+
+// Status is the state of registration.
+type Status struct {
+	State         string    `json:"state"`
+	LastAttempt   time.Time `json:"last_attempt"`
+	LastSuccess   time.Time `json:"last_success"`
+	Failures      int       `json:"consecutive_failures"`
+	TotalFailures uint64    `json:"total_failures"`
+	IpChanges     uint64    `json:"ip_changes"`
+	Maintenance   bool      `json:"maintenance"`
 }
 
 // New creates a Roster from Config.
 func (cfg *Config) New(port int, registrar Registrar, lgr Logger) *Roster {
 
+	var resolver *Resolver
+
 	ip := cfg.Service.IpAddress
 	if ip == "lookup" {
-		ip = getIp()
+		ip = ""
+		resolver = &Resolver{}
+		if cfg.Resolver != nil {
+			resolver = cfg.Resolver.New()
+		}
 	}
 
 	svc := entity.Service{
-		Id:          cfg.Service.Id,
-		Name:        cfg.Service.Name,
-		Tags:        cfg.Service.Tags,
-		IpAddress:   ip,
-		Port:        port,
-		MonitorSpec: cfg.Service.MonitorSpec,
+		Id:                cfg.Service.Id,
+		Name:              cfg.Service.Name,
+		Tags:              cfg.Service.Tags,
+		IpAddress:         ip,
+		Port:              port,
+		MonitorSpec:       cfg.Service.MonitorSpec,
+		Meta:              cfg.Service.Meta,
+		EnableTagOverride: cfg.Service.EnableTagOverride,
+	}
+
+	if cfg.Service.Weights != nil {
+		svc.Weights = entity.Weights{
+			Passing: cfg.Service.Weights.Passing,
+			Warning: cfg.Service.Weights.Warning,
+		}
+	}
+
+	for _, cc := range cfg.Service.Checks {
+		svc.Checks = append(svc.Checks, entity.Check(cc))
 	}
 
 	return &Roster{
-		Registrar: registrar,
-		Logger:    lgr,
-		Service:   svc,
-		Interval:  cfg.Interval,
+		Registrar:       registrar,
+		Logger:          lgr,
+		Service:         svc,
+		Resolver:        resolver,
+		Interval:        cfg.Interval,
+		VerifyInterval:  cfg.VerifyInterval,
+		BackoffMin:      cfg.BackoffMin,
+		BackoffMax:      cfg.BackoffMax,
+		ResolveInterval: cfg.ResolveInterval,
+		Drain:           cfg.Drain,
 	}
 }
 
 // Start starts a Roster service.
 func (roster *Roster) Start(ctx context.Context, wg *sync.WaitGroup) {
 
-	err := roster.Service.Valid()
+	if roster.Resolver != nil && roster.service().IpAddress == "" {
+		ip, err := roster.Resolver.Resolve()
+		if err != nil {
+			roster.Logger.Error(ctx, "worker abort", errors.Wrapf(err, "failed to resolve ip address"), "name", "roster")
+			close(roster.stop())
+			return
+		}
+
+		roster.mu.Lock()
+		roster.Service.IpAddress = ip
+		roster.mu.Unlock()
+	}
+
+	svc := roster.service()
+	err := svc.Valid()
 	if err != nil {
 		roster.Logger.Error(ctx, "worker abort", err, "name", "roster")
+		close(roster.stop())
 		return
 	}
 
@@ -89,28 +249,195 @@ func (roster *Roster) Start(ctx context.Context, wg *sync.WaitGroup) {
 
 	roster.register(ctx)
 
+	wg.Add(1)
 	go roster.work(ctx, wg)
 }
 
+// Stopped returns a channel closed once the worker has stopped, or straight away when Start aborts.
+func (roster *Roster) Stopped() <-chan struct{} {
+
+	return roster.stop()
+}
+
+// Current returns the service as currently registered, its ip address as last resolved.
+func (roster *Roster) Current() entity.Service {
+
+	return roster.service()
+}
+
+// Status returns a snapshot of registration status.
+func (roster *Roster) Status() Status {
+
+	roster.mu.Lock()
+	defer roster.mu.Unlock()
+
+	status := roster.status
+	if status.State == "" {
+		status.State = statePending
+	}
+
+	return status
+}
+
+// GetStatus handles http requests for registration status.
+func (roster *Roster) GetStatus(writer http.ResponseWriter, request *http.Request) {
+
+	ctx := request.Context()
+
+	data, err := json.Marshal(roster.Status())
+	if err != nil {
+		roster.Logger.Error(ctx, "failed to marshal roster status", err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	_, err = writer.Write(data)
+	if err != nil {
+		roster.Logger.Error(ctx, "failed to write roster status to response", err)
+	}
+}
+
+// PutMaintenance handles http requests to enable or disable maintenance mode,
+// with query parameters enable, true or false, and an optional reason.
+// Being unauthenticated, it is for mounting only when MaintenanceApi is configured.
+func (roster *Roster) PutMaintenance(writer http.ResponseWriter, request *http.Request) {
+
+	ctx := request.Context()
+
+	_, ok := roster.Registrar.(Maintainer)
+	if !ok {
+		writer.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	enable, err := strconv.ParseBool(request.URL.Query().Get("enable"))
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	_, err = roster.maintain(ctx, enable, request.URL.Query().Get("reason"))
+	if err != nil {
+		writer.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	roster.GetStatus(writer, request)
+}
+
+// Collect collects registration stats, implementing stator.Collector.
+func (roster *Roster) Collect(ts time.Time) (pa ste.PointsAt, err error) {
+
+	status := roster.Status()
+	svc := roster.service()
+
+	var registered uint64
+	if status.State == stateRegistered {
+		registered = 1
+	}
+
+	pa = ste.PointsAt{
+		Name:  "roster",
+		Stamp: ts,
+		Labels: ste.Labels{
+			{Key: "service", Val: svc.Name},
+			{Key: "service_id", Val: svc.Id},
+		},
+		Points: []ste.Point{
+			{
+				Name:  "registered",
+				Desc:  "Whether the service is currently registered",
+				Type:  "gauge",
+				Value: ste.Uint{Data: registered},
+			},
+			{
+				Name:  "register_failures",
+				Desc:  "Count of failed registration attempts",
+				Unit:  "total",
+				Type:  "counter",
+				Value: ste.Uint{Data: status.TotalFailures},
+			},
+			{
+				Name:  "ip_changes",
+				Desc:  "Count of ip address changes re-registered",
+				Unit:  "total",
+				Type:  "counter",
+				Value: ste.Uint{Data: status.IpChanges},
+			},
+		},
+	}
+	return
+}
+
 // unexported
 
+const (
+	statePending      string = "pending"
+	stateRegistered   string = "registered"
+	stateFailing      string = "failing"
+	stateMissing      string = "missing"
+	stateUnregistered string = "unregistered"
+)
+
 func (roster *Roster) work(ctx context.Context, wg *sync.WaitGroup) {
 
-	// open-loop, just keep registering ftw, but is simple
+	// closed-loop when registrar can verify, and still re-registering periodically for good measure
 
-	wg.Add(1)
 	defer wg.Done()
+	defer close(roster.stop())
 
 	tick := time.NewTicker(roster.Interval)
+	retry := roster.retry()
+
+	var verify <-chan time.Time
+	vfr, ok := roster.Registrar.(Verifier)
+	if ok && roster.VerifyInterval > 0 {
+		verify = time.NewTicker(roster.VerifyInterval).C
+	}
+
+	var beat <-chan time.Time
+	hb, ok := roster.Registrar.(Heartbeater)
+	if ok && hb.HeartbeatPeriod(roster.service()) > 0 {
+		beat = time.NewTicker(hb.HeartbeatPeriod(roster.service())).C
+	}
+
+	var resolve <-chan time.Time
+	if roster.Resolver != nil && roster.ResolveInterval > 0 {
+		resolve = time.NewTicker(roster.ResolveInterval).C
+	}
 
 	for {
 		select {
 		case <-tick.C:
 			roster.register(ctx)
+			retry = roster.retry()
+
+		case <-retry:
+			roster.register(ctx)
+			retry = roster.retry()
+
+		case <-verify:
+			if roster.Status().Failures == 0 && roster.missing(ctx, vfr) {
+				roster.register(ctx)
+				retry = roster.retry()
+			}
+
+		case <-beat:
+			roster.heartbeat(ctx, hb)
+
+		case <-resolve:
+			if roster.moved(ctx) {
+				roster.register(ctx)
+				retry = roster.retry()
+			}
 
 		case <-ctx.Done():
 			roster.Logger.Info(ctx, "worker shutting down")
-			roster.unregister(ctx)
+			if !roster.drain(ctx) {
+				roster.unregister(ctx)
+			}
 			roster.Logger.Info(ctx, "worker stopped")
 			return
 		}
@@ -119,34 +446,249 @@ func (roster *Roster) work(ctx context.Context, wg *sync.WaitGroup) {
 
 func (roster *Roster) register(ctx context.Context) {
 
-	err := roster.Registrar.Register(ctx, roster.Service)
+	err := roster.Registrar.Register(ctx, roster.service())
+
+	roster.mu.Lock()
+
+	roster.status.LastAttempt = time.Now()
+
 	if err != nil {
-		roster.Logger.Error(ctx, "failed to register", err)
+		roster.status.State = stateFailing
+		roster.status.Failures++
+		roster.status.TotalFailures++
+		roster.Logger.Error(ctx, "failed to register", err, "failures", roster.status.Failures)
+		roster.mu.Unlock()
+		return
+	}
+
+	roster.status.State = stateRegistered
+	roster.status.LastSuccess = roster.status.LastAttempt
+	roster.status.Failures = 0
+	roster.mu.Unlock()
+
+	roster.remaintain(ctx)
+}
+
+func (roster *Roster) stop() chan struct{} {
+
+	roster.mu.Lock()
+	defer roster.mu.Unlock()
+
+	if roster.stopped == nil {
+		roster.stopped = make(chan struct{})
+	}
+	return roster.stopped
+}
+
+func (roster *Roster) service() entity.Service {
+
+	roster.mu.Lock()
+	defer roster.mu.Unlock()
+
+	return roster.Service
+}
+
+func (roster *Roster) setState(state string) {
+
+	roster.mu.Lock()
+	defer roster.mu.Unlock()
+
+	roster.status.State = state
+}
+
+func (roster *Roster) missing(ctx context.Context, vfr Verifier) bool {
+
+	ok, err := vfr.Registered(ctx, roster.service())
+	if err != nil {
+		roster.Logger.Error(ctx, "failed to verify registration", err)
+		return false
+	}
+
+	if !ok {
+		roster.setState(stateMissing)
+		roster.Logger.Info(ctx, "registration missing, re-registering")
+	}
+	return !ok
+}
+
+func (roster *Roster) moved(ctx context.Context) bool {
+
+	// unregistering the stale entry, leaving registration under the new address to the caller
+
+	ip, err := roster.Resolver.Resolve()
+	if err != nil {
+		roster.Logger.Error(ctx, "failed to re-resolve ip address", err)
+		return false
+	}
+
+	svc := roster.service()
+	stale := svc.IpAddress
+	if ip == stale {
+		return false
+	}
+
+	roster.Logger.Info(ctx, "ip address changed, re-registering", "from", stale, "to", ip)
+
+	err = roster.Registrar.Unregister(ctx, svc)
+	if err != nil {
+		roster.Logger.Error(ctx, "failed to unregister stale address", err, "ip_address", stale)
+	}
+
+	roster.mu.Lock()
+	roster.Service.IpAddress = ip
+	roster.status.IpChanges++
+	roster.mu.Unlock()
+
+	return true
+}
+
+func (roster *Roster) maintain(ctx context.Context, enable bool, reason string) (ok bool, err error) {
+
+	mtr, ok := roster.Registrar.(Maintainer)
+	if !ok {
+		return
+	}
+
+	err = mtr.Maintenance(ctx, roster.service(), enable, reason)
+	if err != nil {
+		roster.Logger.Error(ctx, "failed to set maintenance", err, "enable", enable)
+		return
+	}
+
+	roster.mu.Lock()
+	roster.status.Maintenance = enable
+	roster.mu.Unlock()
+
+	roster.Logger.Info(ctx, "maintenance set", "enable", enable, "reason", reason)
+	return
+}
+
+func (roster *Roster) remaintain(ctx context.Context) {
+
+	// a fresh registration is out of maintenance, so putting it back when it was in
+
+	if !roster.Status().Maintenance {
+		return
+	}
+
+	mtr, ok := roster.Registrar.(Maintainer)
+	if !ok {
+		return
+	}
+
+	err := mtr.Maintenance(ctx, roster.service(), true, "re-registered while in maintenance")
+	if err != nil {
+		roster.Logger.Error(ctx, "failed to set maintenance", err, "enable", true)
+
+		roster.mu.Lock()
+		roster.status.Maintenance = false
+		roster.mu.Unlock()
 	}
 }
 
+func (roster *Roster) retry() <-chan time.Time {
+
+	failures := roster.Status().Failures
+	if failures == 0 || roster.BackoffMin <= 0 {
+		return nil
+	}
+
+	return time.After(backoff(failures, roster.BackoffMin, roster.BackoffMax))
+}
+
+func (roster *Roster) heartbeat(ctx context.Context, hb Heartbeater) {
+
+	status, note := entity.Passing, ""
+	if roster.Health != nil {
+		status, note = roster.Health(ctx)
+	}
+
+	err := hb.Heartbeat(ctx, roster.service(), status, note)
+	if err != nil {
+		roster.Logger.Error(ctx, "failed to heartbeat", err, "status", status)
+	}
+}
+
+func (roster *Roster) drain(ctx context.Context) (unregistered bool) {
+
+	// in maintenance, the service stays registered and is seen as critical until unregistered after the delay
+
+	if roster.Drain <= 0 {
+		return
+	}
+
+	mtr, ok := roster.Registrar.(Maintainer)
+	if ok {
+		err := mtr.Maintenance(context.WithoutCancel(ctx), roster.service(), true, "shutting down")
+		if err != nil {
+			roster.Logger.Error(ctx, "failed to set maintenance", err, "enable", true)
+		}
+	} else {
+		roster.unregister(ctx)
+		unregistered = true
+	}
+
+	// the first signal having cancelled ctx, listening for another
+
+	signals := roster.signals
+	if signals == nil {
+		signals = notify
+	}
+	interrupt, stop := signals()
+	defer stop()
+
+	timer := time.NewTimer(roster.Drain)
+	defer timer.Stop()
+
+	roster.Logger.Info(ctx, "draining", "delay", roster.Drain)
+
+	select {
+	case <-timer.C:
+	case <-interrupt:
+		roster.Logger.Info(ctx, "drain interrupted")
+	}
+	return
+}
+
 func (roster *Roster) unregister(ctx context.Context) {
 
 	ctx = context.WithoutCancel(ctx)
 
-	err := roster.Registrar.Unregister(ctx, roster.Service)
+	err := roster.Registrar.Unregister(ctx, roster.service())
 	if err != nil {
 		roster.Logger.Error(ctx, "failed to unregister", err)
+		return
 	}
+
+	roster.setState(stateUnregistered)
 }
 
-func getIp() string {
+func notify() (sigs <-chan os.Signal, stop func()) {
 
-	conn, err := net.Dial("udp", "8.8.8.8:80")
-	if err != nil {
-		return "unable to determine external ip"
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+
+	sigs = ch
+	stop = func() { signal.Stop(ch) }
+	return
+}
+
+func backoff(failures int, lower, upper time.Duration) time.Duration {
+
+	// doubling from lower up to upper, then jittered to somewhere in its upper half
+
+	if upper < lower {
+		upper = lower
 	}
-	defer conn.Close()
 
-	localAddr, ok := conn.LocalAddr().(*net.UDPAddr)
-	if !ok {
-		return "somehow failed to assert type on ip addr"
+	delay := lower
+	for i := 1; i < failures && delay < upper; i++ {
+		delay *= 2
+	}
+	if delay > upper {
+		delay = upper
 	}
 
-	return localAddr.IP.String()
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1)) //nolint: gosec
 }
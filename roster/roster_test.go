@@ -2,10 +2,16 @@ package roster
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	ste "stator/entity"
 	"stator/roster/entity"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -83,6 +89,31 @@ var _ = Describe("Roster", func() {
 			})
 		})
 
+		When("service has metadata, weights and checks", func() {
+			var (
+				rosterToo *Roster
+			)
+
+			BeforeEach(func() {
+				cfg.Service.Meta = map[string]string{"version": "1.2.3"}
+				cfg.Service.Weights = &WeightsConfig{Passing: 10, Warning: 1}
+				cfg.Service.EnableTagOverride = true
+				cfg.Service.Checks = []CheckConfig{
+					{Kind: "tcp", Target: "%s:%d", Interval: 30 * time.Second, Timeout: 5 * time.Second},
+				}
+				rosterToo = cfg.New(port, registrar, lgr)
+			})
+
+			It("carries them to the service", func() {
+				Expect(rosterToo.Service.Meta).To(Equal(map[string]string{"version": "1.2.3"}))
+				Expect(rosterToo.Service.Weights).To(Equal(entity.Weights{Passing: 10, Warning: 1}))
+				Expect(rosterToo.Service.EnableTagOverride).To(BeTrue())
+				Expect(rosterToo.Service.Checks).To(Equal([]entity.Check{
+					{Kind: "tcp", Target: "%s:%d", Interval: 30 * time.Second, Timeout: 5 * time.Second},
+				}))
+			})
+		})
+
 		When("looking up ip address", func() {
 			var (
 				rosterToo *Roster
@@ -90,15 +121,278 @@ var _ = Describe("Roster", func() {
 
 			BeforeEach(func() {
 				cfg.Service.IpAddress = "lookup"
+				cfg.Resolver = &ResolverConfig{Prefer: "ipv4"}
 				rosterToo = cfg.New(port, registrar, lgr)
 			})
 
-			It("finds one", func() {
+			It("leaves it to the resolver on start", func() {
+				Expect(rosterToo.Service.IpAddress).To(BeEmpty())
+				Expect(rosterToo.Resolver).To(Equal(&Resolver{Prefer: "ipv4"}))
+
+				var wg sync.WaitGroup
+				ctx, cancel := context.WithCancel(context.Background())
+				rosterToo.Start(ctx, &wg)
+				cancel()
+				wg.Wait()
+
 				Expect(net.ParseIP(rosterToo.Service.IpAddress)).ToNot(BeNil())
 			})
 		})
 	})
 
+	Describe("reporting status", func() {
+		var (
+			ctx context.Context
+		)
+
+		BeforeEach(func() {
+			ctx = context.Background()
+		})
+
+		When("not yet registered", func() {
+			It("is pending", func() {
+				Expect(roster.Status()).To(Equal(Status{State: "pending"}))
+			})
+		})
+
+		When("registration fails twice, then succeeds", func() {
+			var (
+				fails  Status
+				passes Status
+			)
+
+			BeforeEach(func() {
+				registrar.RegisterFunc = func(ctx context.Context, svc entity.Service) error {
+					if len(registrar.RegisterCalls()) < 3 {
+						return fmt.Errorf("oops")
+					}
+					return nil
+				}
+
+				roster.register(ctx)
+				roster.register(ctx)
+				fails = roster.Status()
+				roster.register(ctx)
+				passes = roster.Status()
+			})
+
+			It("tracks attempts, successes and failures", func() {
+				Expect(fails.State).To(Equal("failing"))
+				Expect(fails.Failures).To(Equal(2))
+				Expect(fails.TotalFailures).To(Equal(uint64(2)))
+				Expect(fails.LastAttempt).ToNot(BeZero())
+				Expect(fails.LastSuccess).To(BeZero())
+
+				Expect(passes.State).To(Equal("registered"))
+				Expect(passes.Failures).To(BeZero())
+				Expect(passes.TotalFailures).To(Equal(uint64(2)))
+				Expect(passes.LastSuccess).To(Equal(passes.LastAttempt))
+			})
+
+			It("serves status as json", func() {
+				recorder := httptest.NewRecorder()
+				roster.GetStatus(recorder, httptest.NewRequest("GET", "/roster", nil))
+
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+
+				status := Status{}
+				Expect(json.Unmarshal(recorder.Body.Bytes(), &status)).To(Succeed())
+				Expect(status.State).To(Equal("registered"))
+				Expect(status.TotalFailures).To(Equal(uint64(2)))
+				Expect(recorder.Body.String()).To(ContainSubstring(`"consecutive_failures":0`))
+			})
+
+			It("collects stats", func() {
+				pa, err := roster.Collect(time.Time{})
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(pa).To(Equal(ste.PointsAt{
+					Name: "roster",
+					Labels: ste.Labels{
+						{Key: "service", Val: "bargla"},
+						{Key: "service_id", Val: "123"},
+					},
+					Points: []ste.Point{
+						{
+							Name:  "registered",
+							Desc:  "Whether the service is currently registered",
+							Type:  "gauge",
+							Value: ste.Uint{Data: 1},
+						},
+						{
+							Name:  "register_failures",
+							Desc:  "Count of failed registration attempts",
+							Unit:  "total",
+							Type:  "counter",
+							Value: ste.Uint{Data: 2},
+						},
+						{
+							Name:  "ip_changes",
+							Desc:  "Count of ip address changes re-registered",
+							Unit:  "total",
+							Type:  "counter",
+							Value: ste.Uint{Data: 0},
+						},
+					},
+				}))
+			})
+		})
+	})
+
+	Describe("toggling maintenance", func() {
+		var (
+			mtr      *MaintainerMock
+			query    string
+			recorder *httptest.ResponseRecorder
+		)
+
+		BeforeEach(func() {
+			query = "enable=true&reason=deploying"
+			mtr = &MaintainerMock{
+				MaintenanceFunc: func(ctx context.Context, svc entity.Service, enable bool, reason string) error {
+					return nil
+				},
+			}
+			roster.Registrar = &maintainRegistrar{RegistrarMock: registrar, MaintainerMock: mtr}
+		})
+
+		JustBeforeEach(func() {
+			recorder = httptest.NewRecorder()
+			roster.PutMaintenance(recorder, httptest.NewRequest("PUT", "/roster/maintenance?"+query, nil))
+		})
+
+		When("all goes well", func() {
+			It("sets maintenance and responds with status", func() {
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+
+				mc := mtr.MaintenanceCalls()
+				Expect(mc).To(HaveLen(1))
+				Expect(mc[0].Svc).To(Equal(svc))
+				Expect(mc[0].Enable).To(BeTrue())
+				Expect(mc[0].Reason).To(Equal("deploying"))
+
+				Expect(roster.Status().Maintenance).To(BeTrue())
+				Expect(recorder.Body.String()).To(ContainSubstring(`"maintenance":true`))
+			})
+		})
+
+		When("enable is garbage", func() {
+			BeforeEach(func() {
+				query = "enable=sorta"
+			})
+
+			It("is a bad request", func() {
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(mtr.MaintenanceCalls()).To(BeEmpty())
+			})
+		})
+
+		When("registrar has trouble", func() {
+			BeforeEach(func() {
+				mtr.MaintenanceFunc = func(ctx context.Context, svc entity.Service, enable bool, reason string) error {
+					return fmt.Errorf("oops")
+				}
+			})
+
+			It("logs and responds with bad gateway", func() {
+				Expect(recorder.Code).To(Equal(http.StatusBadGateway))
+				Expect(lgr.ErrorCalls()[0].Msg).To(Equal("failed to set maintenance"))
+				Expect(roster.Status().Maintenance).To(BeFalse())
+			})
+		})
+
+		When("registrar does not support maintenance", func() {
+			BeforeEach(func() {
+				roster.Registrar = registrar
+			})
+
+			It("is not implemented", func() {
+				Expect(recorder.Code).To(Equal(http.StatusNotImplemented))
+			})
+		})
+	})
+
+	Describe("figuring backoff", func() {
+
+		It("doubles from lower to upper with jitter in the upper half", func() {
+			for _, tc := range []struct {
+				failures int
+				delay    time.Duration
+			}{
+				{1, time.Second},
+				{2, 2 * time.Second},
+				{4, 8 * time.Second},
+				{10, time.Minute},
+				{1000, time.Minute},
+			} {
+				bo := backoff(tc.failures, time.Second, time.Minute)
+				Expect(bo).To(BeNumerically(">=", tc.delay/2))
+				Expect(bo).To(BeNumerically("<=", tc.delay))
+			}
+		})
+	})
+
+	Describe("decoding a check config", func() {
+		var (
+			cc  CheckConfig
+			val string
+			err error
+		)
+
+		JustBeforeEach(func() {
+			cc = CheckConfig{}
+			err = cc.Decode(val)
+		})
+
+		When("all goes well", func() {
+			BeforeEach(func() {
+				val = "grpc;%s:%d/grpc.health.v1.Health;30s;5s"
+			})
+
+			It("decodes all the fields", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(cc).To(Equal(CheckConfig{
+					Kind:     "grpc",
+					Target:   "%s:%d/grpc.health.v1.Health",
+					Interval: 30 * time.Second,
+					Timeout:  5 * time.Second,
+				}))
+			})
+		})
+
+		When("timeout is omitted", func() {
+			BeforeEach(func() {
+				val = "ttl;;1m"
+			})
+
+			It("leaves it zero", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(cc).To(Equal(CheckConfig{Kind: "ttl", Interval: time.Minute}))
+			})
+		})
+
+		When("fields are missing", func() {
+			BeforeEach(func() {
+				val = "tcp;%s:%d"
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError("expected kind;target;interval[;timeout], got: tcp;%s:%d"))
+			})
+		})
+
+		When("interval is garbage", func() {
+			BeforeEach(func() {
+				val = "tcp;%s:%d;soon"
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to parse check interval")))
+			})
+		})
+	})
+
 	Describe("starting a roster", func() {
 		var (
 			ctx    context.Context
@@ -108,6 +402,9 @@ var _ = Describe("Roster", func() {
 
 		BeforeEach(func() {
 			ctx, cancel = context.WithCancel(context.Background())
+			DeferCleanup(cancel)
+			wg = sync.WaitGroup{}
+
 			roster.Interval = 100 * time.Millisecond
 		})
 
@@ -133,6 +430,7 @@ var _ = Describe("Roster", func() {
 				Expect(rc()[0].Svc).To(Equal(svc))
 
 				Eventually(rc).Should(HaveLen(2))
+				Expect(roster.Stopped()).ToNot(BeClosed())
 
 				cancel()
 				wg.Wait()
@@ -144,6 +442,39 @@ var _ = Describe("Roster", func() {
 				Expect(uc()).Should(HaveLen(1))
 				Expect(uc()[0].Ctx).To(Equal(context.WithoutCancel(ctx)))
 				Expect(uc()[0].Svc).To(Equal(svc))
+
+				Expect(roster.Status().State).To(Equal("unregistered"))
+				Expect(roster.Stopped()).To(BeClosed())
+			})
+		})
+
+		When("re-registering periodically while in maintenance", func() {
+			var (
+				mtr *MaintainerMock
+			)
+
+			BeforeEach(func() {
+				mtr = &MaintainerMock{
+					MaintenanceFunc: func(ctx context.Context, svc entity.Service, enable bool, reason string) error {
+						return nil
+					},
+				}
+				roster.Registrar = &maintainRegistrar{RegistrarMock: registrar, MaintainerMock: mtr}
+				roster.status.Maintenance = true
+			})
+
+			It("puts each registration back into maintenance", func() {
+
+				Eventually(registrar.RegisterCalls).Should(HaveLen(3))
+				Eventually(mtr.MaintenanceCalls).Should(HaveLen(3))
+
+				mc := mtr.MaintenanceCalls()
+				Expect(mc[2].Enable).To(BeTrue())
+				Expect(mc[2].Reason).To(Equal("re-registered while in maintenance"))
+				Expect(roster.Status().Maintenance).To(BeTrue())
+
+				cancel()
+				wg.Wait()
 			})
 		})
 
@@ -198,6 +529,278 @@ var _ = Describe("Roster", func() {
 			})
 		})
 
+		When("registrar heartbeats", func() {
+			var (
+				hbr *HeartbeaterMock
+			)
+
+			BeforeEach(func() {
+				hbr = &HeartbeaterMock{
+					HeartbeatPeriodFunc: func(svc entity.Service) time.Duration {
+						return 10 * time.Millisecond
+					},
+					HeartbeatFunc: func(ctx context.Context, svc entity.Service, status string, note string) error {
+						return fmt.Errorf("oops")
+					},
+				}
+
+				roster.Registrar = &heartbeatRegistrar{RegistrarMock: registrar, HeartbeaterMock: hbr}
+				roster.Health = func(ctx context.Context) (string, string) {
+					return "warning", "meh"
+				}
+			})
+
+			It("reports health periodically, logging errors", func() {
+
+				Eventually(func() int { return len(hbr.HeartbeatCalls()) }).Should(BeNumerically(">=", 2))
+
+				hc := hbr.HeartbeatCalls()
+				Expect(hc[0].Svc).To(Equal(svc))
+				Expect(hc[0].Status).To(Equal("warning"))
+				Expect(hc[0].Note).To(Equal("meh"))
+
+				Expect(lgr.ErrorCalls()[0].Msg).To(Equal("failed to heartbeat"))
+
+				cancel()
+				wg.Wait()
+			})
+		})
+
+		When("registration fails and backoff is enabled", func() {
+			BeforeEach(func() {
+				roster.Interval = time.Hour
+				roster.BackoffMin = 5 * time.Millisecond
+				roster.BackoffMax = 20 * time.Millisecond
+
+				registrar.RegisterFunc = func(ctx context.Context, svc entity.Service) error {
+					if len(registrar.RegisterCalls()) < 4 {
+						return fmt.Errorf("error from reg")
+					}
+					return nil
+				}
+			})
+
+			It("retries until registered, well before the next interval", func() {
+
+				Eventually(registrar.RegisterCalls).Should(HaveLen(4))
+				Consistently(registrar.RegisterCalls, "50ms").Should(HaveLen(4))
+
+				ec := lgr.ErrorCalls()
+				Expect(ec).To(HaveLen(3))
+				Expect(ec[2].Msg).To(Equal("failed to register"))
+				Expect(ec[2].Kv).To(Equal([]any{"failures", 3}))
+
+				cancel()
+				wg.Wait()
+			})
+		})
+
+		When("registrar verifies and finds the service missing", func() {
+			var (
+				vfr *VerifierMock
+			)
+
+			BeforeEach(func() {
+				roster.Interval = time.Hour
+				roster.VerifyInterval = 10 * time.Millisecond
+
+				vfr = &VerifierMock{
+					RegisteredFunc: func(ctx context.Context, svc entity.Service) (bool, error) {
+						return len(registrar.RegisterCalls()) > 1, nil
+					},
+				}
+				roster.Registrar = &verifyRegistrar{RegistrarMock: registrar, VerifierMock: vfr}
+			})
+
+			It("re-registers straight away", func() {
+
+				Eventually(registrar.RegisterCalls).Should(HaveLen(2))
+				Expect(lgr.InfoCalls()[1].Msg).To(Equal("registration missing, re-registering"))
+
+				Eventually(func() int { return len(vfr.RegisteredCalls()) }).Should(BeNumerically(">=", 3))
+				Expect(registrar.RegisterCalls()).To(HaveLen(2))
+
+				cancel()
+				wg.Wait()
+			})
+		})
+
+		When("draining with a registrar supporting maintenance", func() {
+			var (
+				mtr *MaintainerMock
+			)
+
+			BeforeEach(func() {
+				roster.Drain = 30 * time.Millisecond
+
+				mtr = &MaintainerMock{
+					MaintenanceFunc: func(ctx context.Context, svc entity.Service, enable bool, reason string) error {
+						return nil
+					},
+				}
+				roster.Registrar = &maintainRegistrar{RegistrarMock: registrar, MaintainerMock: mtr}
+			})
+
+			It("goes into maintenance and waits before unregistering", func() {
+
+				cancel()
+				start := time.Now()
+				Eventually(registrar.UnregisterCalls).Should(HaveLen(1))
+				wg.Wait()
+
+				Expect(time.Since(start)).To(BeNumerically(">=", 30*time.Millisecond))
+
+				mc := mtr.MaintenanceCalls()
+				Expect(mc).To(HaveLen(1))
+				Expect(mc[0].Enable).To(BeTrue())
+				Expect(mc[0].Reason).To(Equal("shutting down"))
+
+				ic := lgr.InfoCalls()
+				Expect(ic).To(HaveLen(4))
+				Expect(ic[2].Msg).To(Equal("draining"))
+				Expect(ic[2].Kv).To(Equal([]any{"delay", 30 * time.Millisecond}))
+				Expect(ic[3].Msg).To(Equal("worker stopped"))
+			})
+		})
+
+		When("draining is interrupted", func() {
+			var (
+				sigs chan os.Signal
+			)
+
+			BeforeEach(func() {
+				roster.Drain = time.Hour
+
+				sigs = make(chan os.Signal, 1)
+				roster.signals = func() (<-chan os.Signal, func()) {
+					return sigs, func() {}
+				}
+			})
+
+			It("stops waiting on a further signal", func() {
+
+				cancel()
+				Eventually(lgr.InfoCalls).Should(HaveLen(3))
+				Expect(lgr.InfoCalls()[2].Msg).To(Equal("draining"))
+
+				sigs <- syscall.SIGTERM
+				Eventually(roster.Stopped()).Should(BeClosed())
+				wg.Wait()
+
+				Expect(lgr.InfoCalls()[3].Msg).To(Equal("drain interrupted"))
+				Expect(lgr.InfoCalls()[4].Msg).To(Equal("worker stopped"))
+			})
+		})
+
+		When("draining with a registrar lacking maintenance", func() {
+			BeforeEach(func() {
+				roster.Drain = 30 * time.Millisecond
+			})
+
+			It("unregisters first and then waits", func() {
+
+				cancel()
+				Eventually(lgr.InfoCalls).Should(HaveLen(3))
+				Expect(lgr.InfoCalls()[2].Msg).To(Equal("draining"))
+				Expect(registrar.UnregisterCalls()).To(HaveLen(1))
+				Expect(roster.Status().State).To(Equal("unregistered"))
+
+				Eventually(lgr.InfoCalls).Should(HaveLen(4))
+				wg.Wait()
+
+				Expect(registrar.UnregisterCalls()).To(HaveLen(1))
+			})
+		})
+
+		When("ip address changes", func() {
+			var (
+				ips chan string
+			)
+
+			BeforeEach(func() {
+				ips = make(chan string, 2)
+				ips <- "1.2.3.4"
+				ips <- "5.6.7.8"
+
+				roster.Interval = time.Hour
+				roster.ResolveInterval = 10 * time.Millisecond
+				roster.Resolver = &Resolver{
+					addrs: func() ([]ifaceAddr, error) {
+						ip := "5.6.7.8"
+						select {
+						case ip = <-ips:
+						default:
+						}
+						return []ifaceAddr{{name: "eth0", flags: net.FlagUp, ip: net.ParseIP(ip)}}, nil
+					},
+				}
+			})
+
+			It("unregisters the stale address and registers the new one", func() {
+
+				Eventually(registrar.RegisterCalls).Should(HaveLen(2))
+				Consistently(registrar.RegisterCalls, "50ms").Should(HaveLen(2))
+
+				Expect(registrar.UnregisterCalls()).To(HaveLen(1))
+				Expect(registrar.UnregisterCalls()[0].Svc.IpAddress).To(Equal("1.2.3.4"))
+				Expect(registrar.RegisterCalls()[1].Svc.IpAddress).To(Equal("5.6.7.8"))
+
+				ic := lgr.InfoCalls()
+				Expect(ic[1].Msg).To(Equal("ip address changed, re-registering"))
+				Expect(ic[1].Kv).To(Equal([]any{"from", "1.2.3.4", "to", "5.6.7.8"}))
+
+				Expect(roster.Status().IpChanges).To(Equal(uint64(1)))
+				Expect(roster.Status().State).To(Equal("registered"))
+
+				cancel()
+				wg.Wait()
+			})
+
+			When("in maintenance", func() {
+				var (
+					mtr *MaintainerMock
+				)
+
+				BeforeEach(func() {
+					mtr = &MaintainerMock{
+						MaintenanceFunc: func(ctx context.Context, svc entity.Service, enable bool, reason string) error {
+							return nil
+						},
+					}
+					roster.Registrar = &maintainRegistrar{RegistrarMock: registrar, MaintainerMock: mtr}
+					roster.status.Maintenance = true
+				})
+
+				It("puts the new registration back into maintenance", func() {
+
+					Eventually(mtr.MaintenanceCalls).Should(HaveLen(2))
+
+					mc := mtr.MaintenanceCalls()
+					Expect(mc[1].Svc.IpAddress).To(Equal("5.6.7.8"))
+					Expect(mc[1].Enable).To(BeTrue())
+					Expect(roster.Status().Maintenance).To(BeTrue())
+
+					cancel()
+					wg.Wait()
+				})
+			})
+		})
+
+		When("ip address cannot be resolved", func() {
+			BeforeEach(func() {
+				roster.Service.IpAddress = ""
+				roster.Resolver = &Resolver{Interface: "bargle0"}
+			})
+
+			It("logs the reason and does not reg", func() {
+				Expect(lgr.ErrorCalls()).To(HaveLen(1))
+				Expect(lgr.ErrorCalls()[0].Msg).To(Equal("worker abort"))
+				Expect(lgr.ErrorCalls()[0].Err).To(MatchError(`failed to resolve ip address: no interface named "bargle0" with addresses`))
+
+				Expect(registrar.RegisterCalls()).To(BeEmpty())
+			})
+		})
+
 		When("svc is invalid", func() {
 			BeforeEach(func() {
 				roster.Service.IpAddress = ""
@@ -208,9 +811,25 @@ var _ = Describe("Roster", func() {
 				Expect(lgr.ErrorCalls()[0].Msg).To(Equal("worker abort"))
 
 				Expect(registrar.RegisterCalls()).To(BeEmpty())
+				Expect(roster.Stopped()).To(BeClosed())
 			})
 		})
 
 	})
 
 })
+
+type verifyRegistrar struct {
+	*RegistrarMock
+	*VerifierMock
+}
+
+type heartbeatRegistrar struct {
+	*RegistrarMock
+	*HeartbeaterMock
+}
+
+type maintainRegistrar struct {
+	*RegistrarMock
+	*MaintainerMock
+}
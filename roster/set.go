@@ -0,0 +1,174 @@
+package roster
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	ste "stator/entity"
+)
+
+// Set manages any number of service/registrar pairs, each a Roster of its own.
+//
+// Pairs register, retry, verify and heartbeat independently, so that trouble with one
+// registrar or service does not hold up the others.
+// For example, a process might register both its api and admin ports, or register
+// with two registrars while migrating from one to the other.
+// Each pair is named by its registrar, as given to Add, for status and stats.
+type Set struct {
+	Pairs  []Pair
+	Logger Logger
+}
+
+// Pair is a roster along with the name of its registrar.
+type Pair struct {
+	Registrar string
+	Roster    *Roster
+}
+
+// PairStatus is the registration status of a service/registrar pair.
+type PairStatus struct {
+	Service   string `json:"service"`
+	ServiceId string `json:"service_id"`
+	Registrar string `json:"registrar"`
+	Status
+}
+
+// NewSet creates a Set.
+func NewSet(lgr Logger) *Set {
+
+	return &Set{
+		Logger: lgr,
+	}
+}
+
+// Add adds a roster under the name of its registrar, to be called before Start.
+func (set *Set) Add(registrar string, roster *Roster) {
+
+	set.Pairs = append(set.Pairs, Pair{Registrar: registrar, Roster: roster})
+}
+
+// Start starts each roster concurrently, returning without waiting on any, so that a
+// registrar slow to respond holds up neither the others nor the caller.
+func (set *Set) Start(ctx context.Context, wg *sync.WaitGroup) {
+
+	for _, pair := range set.Pairs {
+		wg.Add(1)
+		go func(roster *Roster) {
+			defer wg.Done()
+			roster.Start(ctx, wg)
+		}(pair.Roster)
+	}
+}
+
+// Stopped returns a channel closed once every roster has stopped.
+func (set *Set) Stopped() <-chan struct{} {
+
+	stopped := make(chan struct{})
+	go func() {
+		for _, pair := range set.Pairs {
+			<-pair.Roster.Stopped()
+		}
+		close(stopped)
+	}()
+
+	return stopped
+}
+
+// Status returns a snapshot of registration status for each pair.
+func (set *Set) Status() (statuses []PairStatus) {
+
+	statuses = []PairStatus{}
+	for _, pair := range set.Pairs {
+		svc := pair.Roster.service()
+		statuses = append(statuses, PairStatus{
+			Service:   svc.Name,
+			ServiceId: svc.Id,
+			Registrar: pair.Registrar,
+			Status:    pair.Roster.Status(),
+		})
+	}
+
+	return
+}
+
+// GetStatus handles http requests for registration status.
+func (set *Set) GetStatus(writer http.ResponseWriter, request *http.Request) {
+
+	ctx := request.Context()
+
+	data, err := json.Marshal(set.Status())
+	if err != nil {
+		set.Logger.Error(ctx, "failed to marshal roster status", err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	_, err = writer.Write(data)
+	if err != nil {
+		set.Logger.Error(ctx, "failed to write roster status to response", err)
+	}
+}
+
+// PutMaintenance handles http requests to enable or disable maintenance mode for each
+// pair supporting it, as with Roster's.
+func (set *Set) PutMaintenance(writer http.ResponseWriter, request *http.Request) {
+
+	ctx := request.Context()
+
+	enable, err := strconv.ParseBool(request.URL.Query().Get("enable"))
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	reason := request.URL.Query().Get("reason")
+
+	var supported, failed bool
+	for _, pair := range set.Pairs {
+		ok, err := pair.Roster.maintain(ctx, enable, reason)
+		supported = supported || ok
+		failed = failed || err != nil
+	}
+
+	switch {
+	case !supported:
+		writer.WriteHeader(http.StatusNotImplemented)
+	case failed:
+		writer.WriteHeader(http.StatusBadGateway)
+	default:
+		set.GetStatus(writer, request)
+	}
+}
+
+// Collect collects registration stats for each pair, implementing stator.Collector.
+//
+// Points are labeled with service, service_id and registrar.
+func (set *Set) Collect(ts time.Time) (pa ste.PointsAt, err error) {
+
+	pa = ste.PointsAt{
+		Name:   "roster",
+		Stamp:  ts,
+		Points: []ste.Point{},
+	}
+
+	for _, pair := range set.Pairs {
+		var one ste.PointsAt
+		one, err = pair.Roster.Collect(ts)
+		if err != nil {
+			return
+		}
+
+		labels := append(one.Labels, ste.Label{Key: "registrar", Val: pair.Registrar})
+		for _, pt := range one.Points {
+			pt.Labels = append(labels[:len(labels):len(labels)], pt.Labels...)
+			pa.Points = append(pa.Points, pt)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,211 @@
+package roster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	ste "stator/entity"
+	"stator/roster/entity"
+)
+
+var _ = Describe("Set", func() {
+	var (
+		api     entity.Service
+		admin   entity.Service
+		good    *RegistrarMock
+		bad     *RegistrarMock
+		lgr     *LoggerMock
+		set     *Set
+		ctx     context.Context
+		cancel  context.CancelFunc
+		wg      sync.WaitGroup
+		started time.Time
+		release chan struct{}
+	)
+
+	BeforeEach(func() {
+		api = entity.Service{
+			Id:          "123",
+			Name:        "bargla",
+			IpAddress:   "1.2.3.4",
+			Port:        8082,
+			MonitorSpec: "http://%s:%d/monitor",
+		}
+		admin = api
+		admin.Name = "bargla-admin"
+		admin.Port = 8083
+
+		good = &RegistrarMock{
+			RegisterFunc: func(ctx context.Context, svc entity.Service) error {
+				return nil
+			},
+			UnregisterFunc: func(ctx context.Context, svc entity.Service) error {
+				return nil
+			},
+		}
+		release = make(chan struct{})
+		bad = &RegistrarMock{
+			RegisterFunc: func(ctx context.Context, svc entity.Service) error {
+				<-release
+				return fmt.Errorf("oops")
+			},
+			UnregisterFunc: func(ctx context.Context, svc entity.Service) error {
+				return nil
+			},
+		}
+
+		lgr = &LoggerMock{
+			InfoFunc:  func(ctx context.Context, msg string, kv ...any) {},
+			ErrorFunc: func(ctx context.Context, msg string, err error, kv ...any) {},
+			WithFieldsFunc: func(ctx context.Context, kv ...interface{}) context.Context {
+				return ctx
+			},
+		}
+
+		set = NewSet(lgr)
+		set.Add("good", &Roster{Registrar: good, Logger: lgr, Service: api, Interval: time.Hour})
+		set.Add("bad", &Roster{Registrar: bad, Logger: lgr, Service: api, Interval: time.Hour})
+		set.Add("good", &Roster{Registrar: good, Logger: lgr, Service: admin, Interval: time.Hour})
+
+		ctx, cancel = context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		wg = sync.WaitGroup{}
+	})
+
+	JustBeforeEach(func() {
+		started = time.Now()
+		set.Start(ctx, &wg)
+	})
+
+	When("one registrar hangs", func() {
+		It("returns straight away and registers the other pairs regardless", func() {
+			Expect(time.Since(started)).To(BeNumerically("<", 50*time.Millisecond))
+
+			Eventually(good.RegisterCalls).Should(HaveLen(2))
+			Eventually(bad.RegisterCalls).Should(HaveLen(1))
+
+			statuses := set.Status()
+			Expect(statuses).To(HaveLen(3))
+
+			Expect(statuses[0].Service).To(Equal("bargla"))
+			Expect(statuses[0].Registrar).To(Equal("good"))
+			Expect(statuses[0].State).To(Equal("registered"))
+			Expect(statuses[1].Registrar).To(Equal("bad"))
+			Expect(statuses[1].State).To(Equal("pending"))
+			Expect(statuses[2].Service).To(Equal("bargla-admin"))
+			Expect(statuses[2].State).To(Equal("registered"))
+
+			close(release)
+			Eventually(func() string { return set.Status()[1].State }).Should(Equal("failing"))
+
+			cancel()
+			wg.Wait()
+
+			Eventually(set.Stopped()).Should(BeClosed())
+			Expect(good.UnregisterCalls()).To(HaveLen(2))
+			Expect(bad.UnregisterCalls()).To(HaveLen(1))
+		})
+	})
+
+	When("one registrar has trouble", func() {
+		JustBeforeEach(func() {
+			close(release)
+			Eventually(func() string { return set.Status()[1].State }).Should(Equal("failing"))
+		})
+
+		It("serves status as json", func() {
+			recorder := httptest.NewRecorder()
+			set.GetStatus(recorder, httptest.NewRequest("GET", "/roster", nil))
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+
+			statuses := []map[string]any{}
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &statuses)).To(Succeed())
+			Expect(statuses).To(HaveLen(3))
+			Expect(statuses[1]).To(HaveKeyWithValue("service", "bargla"))
+			Expect(statuses[1]).To(HaveKeyWithValue("registrar", "bad"))
+			Expect(statuses[1]).To(HaveKeyWithValue("state", "failing"))
+			Expect(statuses[1]).To(HaveKeyWithValue("consecutive_failures", 1.0))
+
+			cancel()
+			wg.Wait()
+		})
+
+		It("collects stats labeled by pair", func() {
+			pa, err := set.Collect(time.Time{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(pa.Name).To(Equal("roster"))
+			Expect(pa.Labels).To(BeEmpty())
+			Expect(pa.Points).To(HaveLen(9))
+
+			Expect(pa.Points[3]).To(Equal(ste.Point{
+				Name: "registered",
+				Desc: "Whether the service is currently registered",
+				Type: "gauge",
+				Labels: ste.Labels{
+					{Key: "service", Val: "bargla"},
+					{Key: "service_id", Val: "123"},
+					{Key: "registrar", Val: "bad"},
+				},
+				Value: ste.Uint{Data: 0},
+			}))
+			Expect(pa.Points[7].Labels[0]).To(Equal(ste.Label{Key: "service", Val: "bargla-admin"}))
+			Expect(pa.Points[7].Value).To(Equal(ste.Uint{Data: 0}))
+
+			cancel()
+			wg.Wait()
+		})
+
+		It("does not set maintenance where none supports it", func() {
+			recorder := httptest.NewRecorder()
+			set.PutMaintenance(recorder, httptest.NewRequest("PUT", "/roster/maintenance?enable=true", nil))
+
+			Expect(recorder.Code).To(Equal(http.StatusNotImplemented))
+
+			cancel()
+			wg.Wait()
+		})
+
+		When("a registrar supports maintenance", func() {
+			var (
+				mtr *MaintainerMock
+			)
+
+			BeforeEach(func() {
+				mtr = &MaintainerMock{
+					MaintenanceFunc: func(ctx context.Context, svc entity.Service, enable bool, reason string) error {
+						return nil
+					},
+				}
+				set.Pairs[2].Roster.Registrar = &maintainRegistrar{RegistrarMock: good, MaintainerMock: mtr}
+			})
+
+			It("sets maintenance for that pair", func() {
+				recorder := httptest.NewRecorder()
+				set.PutMaintenance(recorder, httptest.NewRequest("PUT", "/roster/maintenance?enable=true&reason=upgrade", nil))
+
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				Expect(mtr.MaintenanceCalls()).To(HaveLen(1))
+				Expect(mtr.MaintenanceCalls()[0].Svc.Name).To(Equal("bargla-admin"))
+				Expect(mtr.MaintenanceCalls()[0].Reason).To(Equal("upgrade"))
+
+				statuses := set.Status()
+				Expect(statuses[0].Maintenance).To(BeFalse())
+				Expect(statuses[2].Maintenance).To(BeTrue())
+
+				cancel()
+				wg.Wait()
+			})
+		})
+	})
+})
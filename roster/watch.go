@@ -0,0 +1,127 @@
+package roster
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/clarktrimble/hondo"
+
+	"stator/roster/entity"
+)
+
+// Discoverer specifies a discovery interface.
+type Discoverer interface {
+	Discover(ctx context.Context, name, tag string, index uint64) (svcs []entity.Service, next uint64, err error)
+}
+
+// WatchConfig is Watcher configuration.
+type WatchConfig struct {
+	Name  string        `json:"name" desc:"name of service to watch, none when blank"`
+	Tag   string        `json:"tag" desc:"only watch instances with tag"`
+	Retry time.Duration `json:"retry" desc:"wait after failed discovery" default:"10s"`
+}
+
+// Watcher watches discovery for healthy instances of a service.
+//
+// When Self is set, the instance it returns is left out of those handled, matched by
+// name and id or by address and port, so that a stator watching its own service
+// does not scrape itself.
+type Watcher struct {
+	Discoverer Discoverer
+	Logger     Logger
+	Name       string
+	Tag        string
+	Retry      time.Duration
+	Handler    func(svcs []entity.Service)
+	Self       func() (svc entity.Service)
+}
+
+// New creates a Watcher from WatchConfig.
+func (cfg *WatchConfig) New(dsc Discoverer, lgr Logger, handler func(svcs []entity.Service)) *Watcher {
+
+	return &Watcher{
+		Discoverer: dsc,
+		Logger:     lgr,
+		Name:       cfg.Name,
+		Tag:        cfg.Tag,
+		Retry:      cfg.Retry,
+		Handler:    handler,
+	}
+}
+
+// Start starts a Watcher service.
+//
+// Handler is called with the first discovery and again each time the discovery index moves.
+func (wtc *Watcher) Start(ctx context.Context, wg *sync.WaitGroup) {
+
+	ctx = wtc.Logger.WithFields(ctx, "worker_id", hondo.Rand(7))
+	wtc.Logger.Info(ctx, "worker starting", "name", "watcher", "service", wtc.Name, "tag", wtc.Tag)
+
+	go wtc.work(ctx, wg)
+}
+
+// unexported
+
+func (wtc *Watcher) work(ctx context.Context, wg *sync.WaitGroup) {
+
+	wg.Add(1)
+	defer wg.Done()
+
+	var index uint64
+	first := true
+
+	for {
+		svcs, next, err := wtc.Discoverer.Discover(ctx, wtc.Name, wtc.Tag, index)
+
+		switch {
+		case ctx.Err() != nil:
+			wtc.Logger.Info(ctx, "worker stopped")
+			return
+
+		case err != nil:
+			wtc.Logger.Error(ctx, "failed to discover", err)
+
+			select {
+			case <-time.After(wtc.Retry):
+			case <-ctx.Done():
+				wtc.Logger.Info(ctx, "worker stopped")
+				return
+			}
+			continue
+
+		case first || next != index:
+			wtc.Handler(wtc.others(svcs))
+		}
+
+		// per consul, reset when the index goes backwards, to one rather than zero
+		// so that the next query still blocks
+
+		if next < index || next == 0 {
+			next = 1
+		}
+		index = next
+		first = false
+	}
+}
+
+func (wtc *Watcher) others(svcs []entity.Service) (others []entity.Service) {
+
+	if wtc.Self == nil {
+		return svcs
+	}
+	self := wtc.Self()
+
+	others = []entity.Service{}
+	for _, svc := range svcs {
+		if svc.NameId() == self.NameId() {
+			continue
+		}
+		if self.IpAddress != "" && svc.IpAddress == self.IpAddress && svc.Port == self.Port {
+			continue
+		}
+		others = append(others, svc)
+	}
+
+	return
+}
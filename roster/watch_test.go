@@ -0,0 +1,154 @@
+package roster
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"stator/roster/entity"
+)
+
+var _ = Describe("Watcher", func() {
+	var (
+		cfg     *WatchConfig
+		dsc     *DiscovererMock
+		lgr     *LoggerMock
+		handled chan []entity.Service
+		wtc     *Watcher
+	)
+
+	BeforeEach(func() {
+		cfg = &WatchConfig{
+			Name:  "stator",
+			Tag:   "metrics",
+			Retry: 10 * time.Millisecond,
+		}
+
+		dsc = &DiscovererMock{}
+		lgr = &LoggerMock{
+			InfoFunc:  func(ctx context.Context, msg string, kv ...any) {},
+			ErrorFunc: func(ctx context.Context, msg string, err error, kv ...any) {},
+			WithFieldsFunc: func(ctx context.Context, kv ...interface{}) context.Context {
+				return ctx
+			},
+		}
+
+		handled = make(chan []entity.Service, 10)
+		wtc = cfg.New(dsc, lgr, func(svcs []entity.Service) {
+			handled <- svcs
+		})
+	})
+
+	Describe("starting a watcher", func() {
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+			wg     sync.WaitGroup
+		)
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+		})
+
+		JustBeforeEach(func() {
+			wtc.Start(ctx, &wg)
+		})
+
+		When("all goes well", func() {
+			BeforeEach(func() {
+				// index runs 7, 7, 9, then 3 (backwards), then blocks until cancelled
+
+				indexes := []uint64{7, 7, 9, 3}
+				dsc.DiscoverFunc = func(ctx context.Context, name string, tag string, index uint64) ([]entity.Service, uint64, error) {
+
+					call := len(dsc.DiscoverCalls()) - 1
+					if call >= len(indexes) {
+						<-ctx.Done()
+						return nil, 0, ctx.Err()
+					}
+
+					return []entity.Service{{Id: fmt.Sprintf("%d", call)}}, indexes[call], nil
+				}
+			})
+
+			It("handles first and changed discoveries, and stops when cancelled", func() {
+
+				Eventually(handled).Should(Receive(Equal([]entity.Service{{Id: "0"}})))
+				Eventually(handled).Should(Receive(Equal([]entity.Service{{Id: "2"}})))
+				Eventually(handled).Should(Receive(Equal([]entity.Service{{Id: "3"}})))
+				Consistently(handled).ShouldNot(Receive())
+
+				dc := dsc.DiscoverCalls()
+				Expect(dc).To(HaveLen(5))
+				Expect(dc[0].Name).To(Equal("stator"))
+				Expect(dc[0].Tag).To(Equal("metrics"))
+				Expect(dc[0].Index).To(Equal(uint64(0)))
+				Expect(dc[1].Index).To(Equal(uint64(7)))
+				Expect(dc[2].Index).To(Equal(uint64(7)))
+				Expect(dc[3].Index).To(Equal(uint64(9)))
+				Expect(dc[4].Index).To(Equal(uint64(1)))
+
+				cancel()
+				wg.Wait()
+
+				Eventually(lgr.InfoCalls).Should(HaveLen(2))
+				Expect(lgr.InfoCalls()[0].Msg).To(Equal("worker starting"))
+				Expect(lgr.InfoCalls()[1].Msg).To(Equal("worker stopped"))
+			})
+		})
+
+		When("watching our own service", func() {
+			BeforeEach(func() {
+				wtc.Self = func() entity.Service {
+					return entity.Service{Id: "1", Name: "stator", IpAddress: "1.2.3.4", Port: 8087}
+				}
+
+				dsc.DiscoverFunc = func(ctx context.Context, name string, tag string, index uint64) ([]entity.Service, uint64, error) {
+
+					if len(dsc.DiscoverCalls()) > 1 {
+						<-ctx.Done()
+						return nil, 0, ctx.Err()
+					}
+
+					return []entity.Service{
+						{Id: "1", Name: "stator", IpAddress: "1.2.3.5", Port: 8087},
+						{Id: "2", Name: "stator", IpAddress: "1.2.3.4", Port: 8087},
+						{Id: "3", Name: "stator", IpAddress: "1.2.3.4", Port: 8088},
+					}, 7, nil
+				}
+			})
+
+			It("leaves out the instance matching by id or by address and port", func() {
+
+				Eventually(handled).Should(Receive(Equal([]entity.Service{
+					{Id: "3", Name: "stator", IpAddress: "1.2.3.4", Port: 8088},
+				})))
+
+				cancel()
+				wg.Wait()
+			})
+		})
+
+		When("discovery errors", func() {
+			BeforeEach(func() {
+				dsc.DiscoverFunc = func(ctx context.Context, name string, tag string, index uint64) ([]entity.Service, uint64, error) {
+					return nil, 0, fmt.Errorf("oops")
+				}
+			})
+
+			It("logs errors and keeps trying after retry wait", func() {
+
+				Eventually(func() int { return len(dsc.DiscoverCalls()) }).Should(BeNumerically(">=", 3))
+				Expect(lgr.ErrorCalls()[0].Msg).To(Equal("failed to discover"))
+				Expect(handled).ToNot(Receive())
+
+				cancel()
+				wg.Wait()
+			})
+		})
+	})
+})
@@ -4,12 +4,15 @@ package stator
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
 	"stator/collector/runtime"
+	"stator/collector/scrape"
 	"stator/entity"
 	"stator/formatter/prometheus"
+	rse "stator/roster/entity"
 )
 
 //go:generate moq -out mock_test.go . Collector Formatter Router Logger
@@ -36,8 +39,14 @@ type Logger interface {
 }
 
 // Svc handles requests for stats
+//
+// Unchecked collectors are exposed along with the rest, but do not count toward Health.
+// Scrapers are unchecked as well and, breaking any cycle among stators scraping one
+// another, are not run for requests marked as scrapes themselves.
 type Svc struct {
 	Collectors []Collector
+	Unchecked  []Collector
+	Scrapers   []Collector
 	Formatter  Formatter
 	Logger     Logger
 }
@@ -65,12 +74,28 @@ func (svc *Svc) AddCollector(collector Collector) {
 	svc.Collectors = append(svc.Collectors, collector)
 }
 
+// AddUnchecked adds a collector left out of Health, such as one reporting on other processes.
+func (svc *Svc) AddUnchecked(collector Collector) {
+
+	svc.Unchecked = append(svc.Unchecked, collector)
+}
+
+// AddScraper adds a collector scraping other stats endpoints, possibly other stators.
+func (svc *Svc) AddScraper(collector Collector) {
+
+	svc.Scrapers = append(svc.Scrapers, collector)
+}
+
 // GetStats handles http requests for stats
 func (svc *Svc) GetStats(writer http.ResponseWriter, request *http.Request) {
 
 	ctx := request.Context()
 
-	stats := svc.runCollectors(ctx)
+	stats := svc.runCollectors(ctx, svc.Collectors)
+	stats = append(stats, svc.runCollectors(ctx, svc.Unchecked)...)
+	if request.Header.Get(scrape.Header) == "" {
+		stats = append(stats, svc.runCollectors(ctx, svc.Scrapers)...)
+	}
 	data := svc.format(stats)
 
 	_, err := writer.Write(data)
@@ -79,14 +104,36 @@ func (svc *Svc) GetStats(writer http.ResponseWriter, request *http.Request) {
 	}
 }
 
+// Health reports on collector success, suitable for a registration heartbeat.
+//
+// Status is passing when all collectors succeed, critical when all fail, and warning otherwise.
+// Unchecked collectors are not run.
+func (svc *Svc) Health(ctx context.Context) (status, note string) {
+
+	stats := svc.runCollectors(ctx, svc.Collectors)
+	failed := len(svc.Collectors) - len(stats)
+
+	switch {
+	case failed == 0:
+		status = rse.Passing
+	case failed == len(svc.Collectors):
+		status = rse.Critical
+	default:
+		status = rse.Warning
+	}
+
+	note = fmt.Sprintf("%d of %d collectors failed", failed, len(svc.Collectors))
+	return
+}
+
 // unexported
 
-func (svc *Svc) runCollectors(ctx context.Context) (stats entity.Stats) {
+func (svc *Svc) runCollectors(ctx context.Context, collectors []Collector) (stats entity.Stats) {
 
 	stats = entity.Stats{}
 	now := time.Now()
 
-	for _, collector := range svc.Collectors {
+	for _, collector := range collectors {
 		pts, err := collector.Collect(now)
 		if err != nil {
 			svc.Logger.Error(ctx, "failed to collect stats", err)
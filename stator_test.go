@@ -12,6 +12,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"stator/collector/runtime"
+	"stator/collector/scrape"
 	"stator/entity"
 	"stator/formatter/prometheus"
 )
@@ -78,6 +79,114 @@ var _ = Describe("Stat", func() {
 				Expect(svc.Collectors).To(HaveLen(1))
 			})
 		})
+
+		When("unchecked", func() {
+			BeforeEach(func() {
+				svc.AddUnchecked(&CollectorMock{})
+			})
+
+			It("is appended to Unchecked", func() {
+				Expect(svc.Collectors).To(HaveLen(1))
+				Expect(svc.Unchecked).To(HaveLen(1))
+			})
+		})
+
+		When("a scraper", func() {
+			BeforeEach(func() {
+				svc.AddScraper(&CollectorMock{})
+			})
+
+			It("is appended to Scrapers", func() {
+				Expect(svc.Collectors).To(HaveLen(1))
+				Expect(svc.Scrapers).To(HaveLen(1))
+			})
+		})
+	})
+
+	Describe("reporting health", func() {
+		var (
+			collOne *CollectorMock
+			collTwo *CollectorMock
+			status  string
+			note    string
+		)
+
+		BeforeEach(func() {
+			collOne = &CollectorMock{
+				CollectFunc: func(timeMoqParam time.Time) (entity.PointsAt, error) {
+					return entity.PointsAt{}, nil
+				},
+			}
+			collTwo = &CollectorMock{
+				CollectFunc: func(timeMoqParam time.Time) (entity.PointsAt, error) {
+					return entity.PointsAt{}, nil
+				},
+			}
+
+			svc = &Svc{
+				Collectors: []Collector{collOne, collTwo},
+				Logger:     lgr,
+			}
+		})
+
+		JustBeforeEach(func() {
+			status, note = svc.Health(context.Background())
+		})
+
+		When("all goes well", func() {
+			It("is passing", func() {
+				Expect(status).To(Equal("passing"))
+				Expect(note).To(Equal("0 of 2 collectors failed"))
+			})
+		})
+
+		When("a collector fails", func() {
+			BeforeEach(func() {
+				collOne.CollectFunc = func(timeMoqParam time.Time) (entity.PointsAt, error) {
+					return entity.PointsAt{}, fmt.Errorf("oops")
+				}
+			})
+
+			It("is warning and logs the error", func() {
+				Expect(status).To(Equal("warning"))
+				Expect(note).To(Equal("1 of 2 collectors failed"))
+				Expect(lgr.ErrorCalls()).To(HaveLen(1))
+			})
+		})
+
+		When("all collectors fail", func() {
+			BeforeEach(func() {
+				svc.Collectors = []Collector{
+					&CollectorMock{
+						CollectFunc: func(timeMoqParam time.Time) (entity.PointsAt, error) {
+							return entity.PointsAt{}, fmt.Errorf("oops")
+						},
+					},
+				}
+			})
+
+			It("is critical", func() {
+				Expect(status).To(Equal("critical"))
+				Expect(note).To(Equal("1 of 1 collectors failed"))
+			})
+		})
+
+		When("a collector is unchecked", func() {
+			var (
+				unchecked *CollectorMock
+			)
+
+			BeforeEach(func() {
+				unchecked = &CollectorMock{}
+				svc.Unchecked = []Collector{unchecked}
+			})
+
+			It("is not run", func() {
+				Expect(status).To(Equal("passing"))
+				Expect(note).To(Equal("0 of 2 collectors failed"))
+				Expect(unchecked.CollectCalls()).To(BeEmpty())
+			})
+		})
 	})
 
 	Describe("handling a request for stats", func() {
@@ -145,6 +254,63 @@ var _ = Describe("Stat", func() {
 			})
 		})
 
+		When("there is an unchecked collector", func() {
+			var (
+				unchecked *CollectorMock
+			)
+
+			BeforeEach(func() {
+				writer = httptest.NewRecorder()
+
+				unchecked = &CollectorMock{
+					CollectFunc: func(timeMoqParam time.Time) (entity.PointsAt, error) {
+						return entity.PointsAt{}, nil
+					},
+				}
+				svc.Unchecked = []Collector{unchecked}
+			})
+
+			It("runs it along with the rest", func() {
+				Expect(unchecked.CollectCalls()).To(HaveLen(1))
+				Expect(fmtr.FormatCalls()).To(HaveLen(2))
+			})
+		})
+
+		When("there is a scraper", func() {
+			var (
+				scr *CollectorMock
+			)
+
+			BeforeEach(func() {
+				writer = httptest.NewRecorder()
+
+				scr = &CollectorMock{
+					CollectFunc: func(timeMoqParam time.Time) (entity.PointsAt, error) {
+						return entity.PointsAt{}, nil
+					},
+				}
+				svc.Scrapers = []Collector{scr}
+			})
+
+			It("runs it along with the rest", func() {
+				Expect(scr.CollectCalls()).To(HaveLen(1))
+				Expect(fmtr.FormatCalls()).To(HaveLen(2))
+			})
+
+			When("the request is itself a scrape", func() {
+				BeforeEach(func() {
+					request = &http.Request{Header: http.Header{}}
+					request.Header.Set(scrape.Header, "true")
+				})
+
+				It("does not run it", func() {
+					Expect(scr.CollectCalls()).To(BeEmpty())
+					Expect(collTwo.CollectCalls()).To(HaveLen(1))
+					Expect(fmtr.FormatCalls()).To(HaveLen(1))
+				})
+			})
+		})
+
 		When("write to response fails", func() {
 			BeforeEach(func() {
 				writer = &errorResponder{}